@@ -9,13 +9,16 @@ import (
 
 	"grokml/pkg/ch08-nbayes"
 	ds "grokml/pkg/dataset"
+	"grokml/pkg/metrics"
 	"grokml/pkg/persist"
 	tk "grokml/pkg/tokens"
 )
 
 var train = flag.Bool("t", false, "train model before prediction")
 
-func ROC(model ch08.NaiveBayes, dset ds.DataSet[string], N int) {
+// ROC writes the ROC curve of the model on the dataset as pairs of
+// sensitivity and specificity into a CSV file and returns its AUC.
+func ROC(model ch08.NaiveBayes, dset ds.DataSet[string]) float64 {
 	file, err := os.Create("data/roc.csv")
 	if err != nil {
 		log.Fatal(err)
@@ -24,17 +27,15 @@ func ROC(model ch08.NaiveBayes, dset ds.DataSet[string], N int) {
 	tokeniser := tk.NewTokeniser(true)
 	tmaps := tokeniser.Transform(dset.DPoints())
 
+	roc := metrics.ROCCurve(model.PredictProba(tmaps), dset.Labels())
 	writer := csv.NewWriter(file)
-	for i := 0; i <= N; i++ {
-		th := float64(i) / float64(N)
-		model.Threshold = th
-		model.Score(tmaps, dset.Labels())
-		rep := model.GetReport()
-		sensi := fmt.Sprintf("%v", rep.Recall)
-		speci := fmt.Sprintf("%v", rep.Specificity)
+	for i, tpr := range roc.TPR {
+		sensi := fmt.Sprintf("%v", tpr)
+		speci := fmt.Sprintf("%v", 1.0-roc.FPR[i])
 		writer.Write([]string{sensi, speci})
 	}
 	writer.Flush()
+	return metrics.AUC(roc.FPR, roc.TPR)
 }
 
 func main() {
@@ -91,5 +92,5 @@ func main() {
 	for i, tmap := range tmaps {
 		fmt.Printf("%v -> %.3f (%s)\n", mails[i], nb.Prob(tmap), verbal(preds[i]))
 	}
-	// ROC(nb, testSet, 10000)
+	// ROC(*nb, dset)
 }
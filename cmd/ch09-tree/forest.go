@@ -55,4 +55,8 @@ func main() {
 	rep = fc2.Report
 	fmt.Println("Impurity: Gini")
 	fmt.Printf("report: %+v F-Score: %.4f\n", rep, rep.FScore(1.0))
+	// Feature importances
+	for _, imp := range ch09.NameImportances(fc2.FeatureImportances(), dset.Header()) {
+		fmt.Printf("%-18s %.4f\n", imp.Name, imp.Value)
+	}
 }
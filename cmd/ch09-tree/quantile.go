@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"grokml/pkg/ch09-tree"
+	"grokml/pkg/conformal"
+	ds "grokml/pkg/dataset"
+	"grokml/pkg/persist"
+)
+
+var train = flag.Bool("t", false, "train model before prediction")
+
+func main() {
+
+	flag.Parse()
+
+	csv := ds.NewCSVReader("data/Hyderabad.csv", "Price", "Area", "No. of Bedrooms")
+	dset := ds.NewDataSet(csv, ds.AtoF)
+	trainSet, testSet := dset.Split(0.2)
+	// half of the test set calibrates the conformal intervals
+	calSet, testSet := testSet.Split(0.5)
+
+	var qf *ch09.QuantileForest
+
+	if *train {
+		fmt.Printf("Training on Dataset\nheader: %v size: %d\n", dset.Header(), dset.Size())
+		qf = ch09.NewQuantileForest(20, 0.0)
+		for _, tree := range qf.Estimators {
+			tree.MinSamplesLeaf = 5
+		}
+		qf.Fit(trainSet.DPoints(), trainSet.Labels())
+		persist.Dump(qf, "models/ch09-tree/quantile_forest.json")
+	} else {
+		qf = &ch09.QuantileForest{}
+		persist.Load(qf, "models/ch09-tree/quantile_forest.json")
+	}
+	fmt.Printf("score on test set: %.3f\n", qf.Score(testSet.DPoints(), testSet.Labels()))
+
+	// 80% prediction intervals from the quantiles ...
+	lower, upper := qf.PredictInterval(testSet.DPoints(), 0.2)
+	fmt.Printf("quantile forest coverage: %.3f\n", conformal.Coverage(lower, upper, testSet.Labels()))
+	// ... and from split conformal prediction around the mean
+	cr := conformal.NewConformalRegressor[[]float64](qf, 0.2)
+	cr.Fit(calSet.DPoints(), calSet.Labels())
+	clower, cupper := cr.PredictInterval(testSet.DPoints())
+	fmt.Printf("conformal coverage: %.3f\n", conformal.Coverage(clower, cupper, testSet.Labels()))
+
+	dpoints := [][]float64{{600, 1}, {1000, 2}, {1500, 3}, {2000, 4}}
+	median := qf.PredictQuantile(dpoints, 0.5)
+	lower, upper = qf.PredictInterval(dpoints, 0.2)
+	for i, dpoint := range dpoints {
+		fmt.Printf("Predicted: %v -> %.0f in [%.0f, %.0f]\n", dpoint, median[i], lower[i], upper[i])
+	}
+}
@@ -56,6 +56,7 @@ func main() {
 	rep = ac2.Report
 	fmt.Println("Impurity: Gini")
 	fmt.Printf("report: %+v F-Score: %.4f\n", rep, rep.FScore(1.0))
+	fmt.Printf("accuracy per boosting round: %.4f\n", ac2.StagedScore(testSet.DPoints(), testSet.Labels()))
 
 	dpoints := testSet.DPoints()
 	labels := ac1.Predict(dpoints)
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"grokml/pkg/ch09-tree"
+	"grokml/pkg/ch12-ensemble"
+	"grokml/pkg/codegen"
+	"grokml/pkg/persist"
+)
+
+var (
+	kind = flag.String("m", "", "model kind: tree-classifier, tree-regressor, forest, forest-regressor, extratrees, extratrees-regressor, adaboost or gradboost")
+	src  = flag.String("i", "", "input model file (.json, .gob, optionally .gz)")
+	dst  = flag.String("o", "", "output Go file (stdout if empty)")
+	pkg  = flag.String("p", "model", "package of the generated code")
+	name = flag.String("f", "Predict", "name of the prediction function")
+)
+
+// model is the interface of the models that can be loaded and compiled.
+type model interface {
+	persist.JSONable
+	codegen.Predictor
+}
+
+// models maps the model kinds to constructors of empty models
+// ready to be filled by persist.Load.
+var models = map[string]func() model{
+	"tree-classifier":      func() model { return &ch09.TreeClassifier{} },
+	"tree-regressor":       func() model { return &ch09.TreeRegressor{} },
+	"forest":               func() model { return &ch09.ForestClassifier{} },
+	"forest-regressor":     func() model { return &ch09.ForestRegressor{} },
+	"extratrees":           func() model { return &ch09.ExtraTreesClassifier{} },
+	"extratrees-regressor": func() model { return &ch09.ExtraTreesRegressor{} },
+	"adaboost":             func() model { return &ch12.AdaBoostClassifier{} },
+	"gradboost":            func() model { return &ch12.GradBoostRegressor{} },
+}
+
+// Compiles a persisted model to standalone Go code, e.g.
+//
+//	go run cmd/codegen/codegen.go -m adaboost -i models/ch09-tree/adaBoost.json -o model.go
+func main() {
+
+	flag.Parse()
+
+	newModel, ok := models[*kind]
+	if !ok {
+		log.Fatalf("unknown model kind %q", *kind)
+	}
+	m := newModel()
+	if err := persist.Load(m, *src); err != nil {
+		log.Fatal(err)
+	}
+	code, err := codegen.Generate(m, *pkg, *name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dst == "" {
+		fmt.Print(string(code))
+		return
+	}
+	if err := os.WriteFile(*dst, code, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("generated %s from %s model %s\n", *dst, *kind, *src)
+}
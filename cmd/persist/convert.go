@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+
+	"grokml/pkg/ch03-linreg"
+	"grokml/pkg/ch05-percept"
+	"grokml/pkg/ch06-logreg"
+	"grokml/pkg/ch08-nbayes"
+	"grokml/pkg/ch09-tree"
+	"grokml/pkg/ch12-ensemble"
+	"grokml/pkg/persist"
+	vc "grokml/pkg/vector"
+)
+
+var (
+	kind = flag.String("m", "", "model kind (see -l)")
+	src  = flag.String("i", "", "input model file (.json, .gob, optionally .gz)")
+	dst  = flag.String("o", "", "output model file (.json, .gob, optionally .gz)")
+	list = flag.Bool("l", false, "list model kinds")
+)
+
+// models maps the model kinds to constructors of empty models
+// ready to be filled by persist.Load.
+var models = map[string]func() persist.JSONable{
+	"linreg":               func() persist.JSONable { return &ch03.LinReg{} },
+	"reglin":               func() persist.JSONable { return &ch03.RegLin{LinReg: &ch03.LinReg{}} },
+	"perceptron-num":       func() persist.JSONable { return ch05.NewNumPerceptron(0, 0.0) },
+	"perceptron-text":      func() persist.JSONable { return ch05.NewTextPerceptron(0, 0.0) },
+	"logreg-num":           func() persist.JSONable { return ch06.NewNumLogReg(0, 0.0) },
+	"logreg-text":          func() persist.JSONable { return ch06.NewTextLogReg(0, 0.0) },
+	"nbayes":               func() persist.JSONable { return &ch08.NaiveBayes{} },
+	"tree-classifier":      func() persist.JSONable { return &ch09.TreeClassifier{} },
+	"tree-regressor":       func() persist.JSONable { return &ch09.TreeRegressor{} },
+	"forest":               func() persist.JSONable { return &ch09.ForestClassifier{} },
+	"forest-regressor":     func() persist.JSONable { return &ch09.ForestRegressor{} },
+	"extratrees":           func() persist.JSONable { return &ch09.ExtraTreesClassifier{} },
+	"extratrees-regressor": func() persist.JSONable { return &ch09.ExtraTreesRegressor{} },
+	"quantile-forest":      func() persist.JSONable { return &ch09.QuantileForest{} },
+	"adaboost":             func() persist.JSONable { return &ch12.AdaBoostClassifier{} },
+	"gradboost":            func() persist.JSONable { return &ch12.GradBoostRegressor{} },
+	"gradboost-classifier": func() persist.JSONable { return &ch12.GradBoostClassifier{} },
+	"isolation-forest":     func() persist.JSONable { return &ch12.IsolationForest{} },
+	"scaler":               func() persist.JSONable { return vc.NewScaler() },
+}
+
+// Converts a model file between JSON and gob, e.g.
+//
+//	go run cmd/persist/convert.go -m forest -i models/ch09-tree/forest.json -o forest.gob.gz
+func main() {
+
+	flag.Parse()
+
+	if *list {
+		kinds := make([]string, 0, len(models))
+		for k := range models {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		for _, k := range kinds {
+			fmt.Println(k)
+		}
+		return
+	}
+
+	newModel, ok := models[*kind]
+	if !ok {
+		log.Fatalf("unknown model kind %q, use -l to list the kinds", *kind)
+	}
+	if err := persist.Convert(newModel(), *src, *dst); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("converted %s model %s -> %s\n", *kind, *src, *dst)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
 
 	"grokml/pkg/ch06-logreg"
 	"grokml/pkg/ch09-tree"
@@ -28,20 +29,15 @@ func main() {
 	trainPts, trainLbs := trainSet.DPoints(), trainSet.Labels()
 	testPts, testLbs := testSet.DPoints(), testSet.Labels()
 
+	// All models are kept in the registry, the production versions are used.
+	reg := persist.NewRegistry("models/registry")
+
 	var lc *ch06.LogReg[vc.Vector]
 	sc := vc.NewScaler()
 	veciser := vc.NewVectoriser(true)
-	logreg := "models/ch06-logreg/logr_titanic.json"
-	scaler := "models/ch06-logreg/scaler_titanic.json"
-
 	var dt ch09.TreeClassifier
-	tree := "models/ch09-tree/titanic_tree.json"
-
 	var fc *ch09.ForestClassifier
-	forest := "models/ch09-tree/titanic_forest.json"
-
 	var ac *ch12.AdaBoostClassifier
-	booster := "models/ch09-tree/titanic_booster.json"
 
 	if *train {
 		// Logistic Regression
@@ -50,34 +46,34 @@ func main() {
 		sc.Fit(dps)
 		dps = sc.Transform(dps)
 		lc.Fit(dps, trainLbs)
-		persist.Dump(lc, logreg)
-		persist.Dump(sc, scaler)
+		publish(reg, lc, "titanic_logreg")
+		publish(reg, sc, "titanic_scaler")
 		// decision tree
 		dt = ch09.NewTreeClassifier(ch09.Entropy, 0.1)
 		dt.Fit(trainPts, trainLbs)
-		persist.Dump(&dt, tree)
+		publish(reg, &dt, "titanic_tree")
 		// forest classifier
 		fc = ch09.NewForestClassifier(3, ch09.Entropy, 0.1)
 		fc.Fit(trainPts, trainLbs)
-		persist.Dump(fc, forest)
+		publish(reg, fc, "titanic_forest")
 		// AdaBoost classifier
 		ac = ch12.NewAdaBoostClassifier(3, ch09.Entropy, 0.1)
 		ac.Fit(trainPts, trainLbs)
-		persist.Dump(ac, booster)
+		publish(reg, ac, "titanic_booster")
 	} else {
 		// Logistic Regression
 		lc = ch06.NewNumLogReg(0.0, 0.0)
-		persist.Load(lc, logreg)
-		persist.Load(sc, scaler)
+		fetch(reg, lc, "titanic_logreg")
+		fetch(reg, sc, "titanic_scaler")
 		// decision tree
 		dt = ch09.TreeClassifier{}
-		persist.Load(&dt, tree)
+		fetch(reg, &dt, "titanic_tree")
 		// forest classifier
 		fc = &ch09.ForestClassifier{}
-		persist.Load(fc, forest)
+		fetch(reg, fc, "titanic_forest")
 		// AdaBoost classifier
 		ac = &ch12.AdaBoostClassifier{}
-		persist.Load(ac, booster)
+		fetch(reg, ac, "titanic_booster")
 	}
 
 	// Logistic Regression classifier
@@ -105,3 +101,23 @@ func main() {
 	fmt.Printf("report: %+v F-Score: %.4f\n", rep, rep.FScore(1.0))
 
 }
+
+// publish saves the model as a new version in the registry and promotes
+// it to production.
+func publish(reg *persist.Registry, jn persist.JSONable, name string) {
+	version, err := reg.Save(jn, name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := reg.Promote(name, version, persist.Production); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("saved %s version %d\n", name, version)
+}
+
+// fetch loads the production version of the model from the registry.
+func fetch(reg *persist.Registry, jn persist.JSONable, name string) {
+	if err := reg.LoadStage(jn, name, persist.Production); err != nil {
+		log.Fatalf("%v (train the models with -t first)", err)
+	}
+}
@@ -0,0 +1,97 @@
+package calibration
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"grokml/pkg/ch09-tree"
+)
+
+// overconfident is a helper function that draws labels with probability p
+// and returns them together with overconfident estimates of p.
+func overconfident(n int) ([]float64, []float64) {
+	rng := rand.New(rand.NewSource(1))
+	probs := make([]float64, n)
+	labels := make([]float64, n)
+	for i := range probs {
+		p := rng.Float64()
+		if rng.Float64() < p {
+			labels[i] = 1.0
+		}
+		probs[i] = 1.0 / (1.0 + math.Exp(-4.0*logit(p)))
+	}
+	return probs, labels
+}
+
+func TestPlatt(t *testing.T) {
+	probs, labels := overconfident(2000)
+	pt := NewPlatt()
+	pt.Fit(probs, labels)
+	// The overconfidence is undone by A = -1/4.
+	if math.Abs(pt.A+0.25) > 0.05 || math.Abs(pt.B) > 0.1 {
+		t.Errorf("expected A = -0.25 and B = 0, got A = %.3f and B = %.3f", pt.A, pt.B)
+	}
+	before, after := BrierScore(probs, labels), BrierScore(pt.Transform(probs), labels)
+	if after >= before {
+		t.Errorf("expected Brier score below %.4f, got %.4f", before, after)
+	}
+}
+
+func TestIsotonic(t *testing.T) {
+	it := NewIsotonic()
+	it.Fit([]float64{0.1, 0.2, 0.3, 0.4, 0.4, 0.8}, []float64{0, 1, 0, 1, 1, 1})
+	exp := []float64{0, 0.5, 0.5, 1, 1, 1}
+	got := it.Transform([]float64{0.1, 0.2, 0.3, 0.4, 0.6, 0.9})
+	for i, val := range exp {
+		if math.Abs(got[i]-val) > 1e-9 {
+			t.Errorf("expected calibrated probability %v, got %v", val, got[i])
+		}
+	}
+	probs, labels := overconfident(2000)
+	it.Fit(probs, labels)
+	before, after := BrierScore(probs, labels), BrierScore(it.Transform(probs), labels)
+	if after >= before {
+		t.Errorf("expected Brier score below %.4f, got %.4f", before, after)
+	}
+}
+
+func TestReliabilityCurve(t *testing.T) {
+	probs := []float64{0.05, 0.15, 0.15, 0.95, 1.0}
+	labels := []float64{0, 0, 1, 1, 1}
+	rel := ReliabilityCurve(probs, labels, 10)
+	expCounts := []int{1, 2, 2}
+	expFrac := []float64{0, 0.5, 1}
+	if len(rel.Counts) != len(expCounts) {
+		t.Fatalf("expected %d bins, got %d", len(expCounts), len(rel.Counts))
+	}
+	for i, count := range expCounts {
+		if rel.Counts[i] != count || rel.FracPos[i] != expFrac[i] {
+			t.Errorf("expected bin %d with %d examples and fraction %v, got %d and %v",
+				i, count, expFrac[i], rel.Counts[i], rel.FracPos[i])
+		}
+	}
+}
+
+func TestCalibratedClassifier(t *testing.T) {
+	dpoints := [][]float64{
+		{7, 1}, {3, 2}, {2, 3}, {1, 5}, {2, 6}, {4, 7},
+		{1, 9}, {8, 10}, {6, 5}, {7, 8}, {8, 4}, {9, 6},
+	}
+	labels := []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1}
+	train := func(dpoints [][]float64, labels []float64) Classifier[[]float64] {
+		dt := ch09.NewTreeClassifier(ch09.Gini, 0.1)
+		dt.Fit(dpoints, labels)
+		return &dt
+	}
+	cc := NewCalibratedClassifier[[]float64](nil, NewIsotonic())
+	cc.FitCV(train, 3, dpoints, labels)
+	for _, p := range cc.PredictProba(dpoints) {
+		if p < 0.0 || p > 1.0 {
+			t.Errorf("expected probability in [0, 1], got %v", p)
+		}
+	}
+	if acc := cc.Score(dpoints, labels); acc < 0.5 {
+		t.Errorf("expected accuracy of at least 0.5, got %.3f", acc)
+	}
+}
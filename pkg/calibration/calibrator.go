@@ -0,0 +1,254 @@
+// Implements the calibration of classifier probabilities.
+package calibration
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// init registers the calibrators with gob.
+func init() {
+	gob.Register(&Platt{})
+	gob.Register(&Isotonic{})
+}
+
+// Calibrator is the interface for engines that map the probabilities
+// estimated by a classifier to calibrated ones.
+type Calibrator interface {
+	Fit(probs []float64, labels []float64)
+	Transform(probs []float64) []float64
+}
+
+// eps keeps probabilities away from 0 and 1 before taking logits.
+const eps = 1e-12
+
+// logit is a helper function computing the log-odds of a probability.
+func logit(p float64) float64 {
+	p = math.Max(eps, math.Min(1.0-eps, p))
+	return math.Log(p / (1.0 - p))
+}
+
+// Platt implements Platt scaling: the calibrated probability is the sigmoid
+// 1 / (1 + exp(A*f + B)) of the log-odds f of the uncalibrated probability.
+type Platt struct {
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+}
+
+// NewPlatt is the constructor function for Platt.
+func NewPlatt() *Platt {
+	return &Platt{}
+}
+
+// Fit finds the parameters A and B by minimising the cross-entropy with
+// Newton's method and backtracking, following Lin, Lin and Weng (2007).
+// The labels are smoothed with Platt's out-of-sample targets.
+func (pt *Platt) Fit(probs []float64, labels []float64) {
+	var prior0, prior1 float64
+	for _, label := range labels {
+		if label > 0.5 {
+			prior1++
+		} else {
+			prior0++
+		}
+	}
+	hiTarget := (prior1 + 1.0) / (prior1 + 2.0)
+	loTarget := 1.0 / (prior0 + 2.0)
+	fs := make([]float64, len(probs))
+	ts := make([]float64, len(probs))
+	for i, p := range probs {
+		fs[i] = logit(p)
+		ts[i] = loTarget
+		if labels[i] > 0.5 {
+			ts[i] = hiTarget
+		}
+	}
+	// objective is the cross-entropy for the parameters a and b.
+	objective := func(a, b float64) float64 {
+		var val float64
+		for i, f := range fs {
+			fApB := f*a + b
+			if fApB >= 0 {
+				val += ts[i]*fApB + math.Log1p(math.Exp(-fApB))
+			} else {
+				val += (ts[i]-1.0)*fApB + math.Log1p(math.Exp(fApB))
+			}
+		}
+		return val
+	}
+	const (
+		maxIter = 100
+		minStep = 1e-10
+		sigma   = 1e-12
+	)
+	a, b := 0.0, math.Log((prior0+1.0)/(prior1+1.0))
+	fval := objective(a, b)
+	for it := 0; it < maxIter; it++ {
+		// gradient and Hessian
+		h11, h22, h21, g1, g2 := sigma, sigma, 0.0, 0.0, 0.0
+		for i, f := range fs {
+			fApB := f*a + b
+			var p, q float64
+			if fApB >= 0 {
+				p = math.Exp(-fApB) / (1.0 + math.Exp(-fApB))
+				q = 1.0 / (1.0 + math.Exp(-fApB))
+			} else {
+				p = 1.0 / (1.0 + math.Exp(fApB))
+				q = math.Exp(fApB) / (1.0 + math.Exp(fApB))
+			}
+			d2 := p * q
+			h11 += f * f * d2
+			h22 += d2
+			h21 += f * d2
+			d1 := ts[i] - p
+			g1 += f * d1
+			g2 += d1
+		}
+		if math.Abs(g1) < 1e-5 && math.Abs(g2) < 1e-5 {
+			break
+		}
+		// Newton direction
+		det := h11*h22 - h21*h21
+		dA := -(h22*g1 - h21*g2) / det
+		dB := -(-h21*g1 + h11*g2) / det
+		gd := g1*dA + g2*dB
+		step := 1.0
+		for step >= minStep {
+			newA, newB := a+step*dA, b+step*dB
+			newf := objective(newA, newB)
+			if newf < fval+1e-4*step*gd {
+				a, b, fval = newA, newB, newf
+				break
+			}
+			step /= 2.0
+		}
+		if step < minStep {
+			break
+		}
+	}
+	pt.A, pt.B = a, b
+}
+
+// Transform computes the calibrated probabilities.
+func (pt Platt) Transform(probs []float64) []float64 {
+	res := make([]float64, len(probs))
+	for i, p := range probs {
+		fApB := logit(p)*pt.A + pt.B
+		if fApB >= 0 {
+			res[i] = math.Exp(-fApB) / (1.0 + math.Exp(-fApB))
+		} else {
+			res[i] = 1.0 / (1.0 + math.Exp(fApB))
+		}
+	}
+	return res
+}
+
+// Marshal and Unmarshal implement the JSONable interface (persist pkg).
+func (pt Platt) Marshal() ([]byte, error) {
+	return json.MarshalIndent(pt, "", "    ")
+}
+
+func (pt *Platt) Unmarshal(bs []byte) error {
+	return json.Unmarshal(bs, pt)
+}
+
+// Isotonic implements isotonic regression: the calibrated probability is a
+// non-decreasing piecewise-linear function of the uncalibrated one, given by
+// the knots X and Y.
+type Isotonic struct {
+	X []float64 `json:"x"`
+	Y []float64 `json:"y"`
+}
+
+// NewIsotonic is the constructor function for Isotonic.
+func NewIsotonic() *Isotonic {
+	return &Isotonic{}
+}
+
+// block is a helper struct for the pool-adjacent-violators algorithm. It
+// holds the range of inputs [lo, hi] pooled together, their mean label
+// and their number.
+type block struct {
+	lo, hi float64
+	mean   float64
+	weight float64
+}
+
+// Fit performs isotonic regression of the labels on the probabilities with
+// the pool-adjacent-violators algorithm.
+func (it *Isotonic) Fit(probs []float64, labels []float64) {
+	idx := make([]int, len(probs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return probs[idx[i]] < probs[idx[j]] })
+	var blocks []block
+	for _, i := range idx {
+		p, label := probs[i], labels[i]
+		// equal inputs are pooled right away
+		if n := len(blocks); n > 0 && blocks[n-1].hi == p {
+			last := &blocks[n-1]
+			last.mean = (last.mean*last.weight + label) / (last.weight + 1.0)
+			last.weight++
+		} else {
+			blocks = append(blocks, block{p, p, label, 1.0})
+		}
+		// pool adjacent violators
+		for n := len(blocks); n > 1 && blocks[n-2].mean >= blocks[n-1].mean; n-- {
+			prev, last := blocks[n-2], blocks[n-1]
+			weight := prev.weight + last.weight
+			blocks[n-2] = block{
+				lo:     prev.lo,
+				hi:     last.hi,
+				mean:   (prev.mean*prev.weight + last.mean*last.weight) / weight,
+				weight: weight,
+			}
+			blocks = blocks[:n-1]
+		}
+	}
+	it.X, it.Y = nil, nil
+	for _, bl := range blocks {
+		it.X = append(it.X, bl.lo)
+		it.Y = append(it.Y, bl.mean)
+		if bl.hi > bl.lo {
+			it.X = append(it.X, bl.hi)
+			it.Y = append(it.Y, bl.mean)
+		}
+	}
+}
+
+// Transform computes the calibrated probabilities by linear interpolation
+// between the knots. Probabilities outside the knots are clipped.
+func (it Isotonic) Transform(probs []float64) []float64 {
+	res := make([]float64, len(probs))
+	n := len(it.X)
+	if n == 0 {
+		copy(res, probs)
+		return res
+	}
+	for i, p := range probs {
+		j := sort.SearchFloat64s(it.X, p)
+		switch {
+		case j == 0:
+			res[i] = it.Y[0]
+		case j == n:
+			res[i] = it.Y[n-1]
+		default:
+			x0, x1 := it.X[j-1], it.X[j]
+			y0, y1 := it.Y[j-1], it.Y[j]
+			res[i] = y0 + (y1-y0)*(p-x0)/(x1-x0)
+		}
+	}
+	return res
+}
+
+// Marshal and Unmarshal implement the JSONable interface (persist pkg).
+func (it Isotonic) Marshal() ([]byte, error) {
+	return json.MarshalIndent(it, "", "    ")
+}
+
+func (it *Isotonic) Unmarshal(bs []byte) error {
+	return json.Unmarshal(bs, it)
+}
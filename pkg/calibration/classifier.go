@@ -0,0 +1,111 @@
+package calibration
+
+import (
+	"encoding/json"
+
+	pl "grokml/pkg/pipeline"
+)
+
+// Classifier is the interface of classifiers whose probabilities can be
+// calibrated. All classifiers of this repo satisfy it for their data point
+// type D, e.g. ch06.LogReg for vectors and ch09.ForestClassifier for
+// slices of floats.
+type Classifier[D any] interface {
+	PredictProba(dpoints []D) []float64
+}
+
+// TrainFunc trains a fresh classifier on the given examples. It is used to
+// obtain out-of-fold predictions for cross-validated calibration.
+type TrainFunc[D any] func(dpoints []D, labels []float64) Classifier[D]
+
+// CalibratedClassifier wraps a classifier and calibrates its probabilities.
+// Only the calibrator is persisted; the base classifier is dumped and loaded
+// on its own.
+type CalibratedClassifier[D any] struct {
+	Base       Classifier[D] `json:"-"`
+	Calibrator Calibrator    `json:"calibrator"`
+	Report     pl.Report     `json:"-"`
+}
+
+// NewCalibratedClassifier is the constructor function for CalibratedClassifier.
+// The base classifier may be nil if it is to be trained with FitCV.
+func NewCalibratedClassifier[D any](base Classifier[D], cal Calibrator) *CalibratedClassifier[D] {
+	return &CalibratedClassifier[D]{Base: base, Calibrator: cal}
+}
+
+// Fit calibrates the probabilities of the already trained base classifier
+// on held-out examples, ie examples that the base classifier was not
+// trained on.
+func (cc *CalibratedClassifier[D]) Fit(dpoints []D, labels []float64) {
+	cc.Calibrator.Fit(cc.Base.PredictProba(dpoints), labels)
+}
+
+// FitCV performs cross-validated calibration: the examples are split into k
+// folds, and for every fold a classifier trained on the others predicts its
+// probabilities. The calibrator is fitted on these out-of-fold probabilities,
+// and the base classifier is trained on all examples.
+func (cc *CalibratedClassifier[D]) FitCV(train TrainFunc[D], k int, dpoints []D, labels []float64) {
+	probs := CrossValPredict(train, k, dpoints, labels)
+	cc.Calibrator.Fit(probs, labels)
+	cc.Base = train(dpoints, labels)
+}
+
+// CrossValPredict computes out-of-fold probabilities. Example i belongs to
+// fold i % k so that the order of the given slices is left untouched.
+func CrossValPredict[D any](train TrainFunc[D], k int, dpoints []D, labels []float64) []float64 {
+	probs := make([]float64, len(dpoints))
+	for fold := 0; fold < k; fold++ {
+		var trainPts, testPts []D
+		var trainLbs []float64
+		var testIdx []int
+		for i, dpoint := range dpoints {
+			if i%k == fold {
+				testPts = append(testPts, dpoint)
+				testIdx = append(testIdx, i)
+			} else {
+				trainPts = append(trainPts, dpoint)
+				trainLbs = append(trainLbs, labels[i])
+			}
+		}
+		if len(testPts) == 0 {
+			continue
+		}
+		clf := train(trainPts, trainLbs)
+		for j, p := range clf.PredictProba(testPts) {
+			probs[testIdx[j]] = p
+		}
+	}
+	return probs
+}
+
+// PredictProba returns the calibrated probabilities of the positive class.
+func (cc *CalibratedClassifier[D]) PredictProba(dpoints []D) []float64 {
+	return cc.Calibrator.Transform(cc.Base.PredictProba(dpoints))
+}
+
+// PredictClass labels the data points whose calibrated probability exceeds
+// the threshold with 1.
+func (cc *CalibratedClassifier[D]) PredictClass(dpoints []D, threshold float64) []float64 {
+	return pl.Classify(cc.PredictProba(dpoints), threshold)
+}
+
+// Predict labels the data points at the threshold 0.5.
+func (cc *CalibratedClassifier[D]) Predict(dpoints []D) []float64 {
+	return cc.PredictClass(dpoints, 0.5)
+}
+
+// Score computes the quantities of a Report struct and returns the accuracy.
+func (cc *CalibratedClassifier[D]) Score(dpoints []D, labels []float64) float64 {
+	cc.Report = pl.GetReport(cc.Predict(dpoints), labels)
+	return cc.Report.Accuracy
+}
+
+// Marshal and Unmarshal implement the JSONable interface (persist pkg).
+// As with LogReg, the calibrator must be set before unmarshalling.
+func (cc CalibratedClassifier[D]) Marshal() ([]byte, error) {
+	return json.MarshalIndent(cc, "", "    ")
+}
+
+func (cc *CalibratedClassifier[D]) Unmarshal(bs []byte) error {
+	return json.Unmarshal(bs, cc)
+}
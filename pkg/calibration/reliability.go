@@ -0,0 +1,50 @@
+package calibration
+
+import "grokml/pkg/metrics"
+
+// Reliability holds the data of a reliability diagram. For every non-empty
+// bin of predicted probabilities, it holds their mean, the fraction of
+// positive examples among them and their number. A well-calibrated
+// classifier has MeanPred close to FracPos in every bin.
+type Reliability struct {
+	MeanPred []float64 `json:"mean_pred"`
+	FracPos  []float64 `json:"frac_pos"`
+	Counts   []int     `json:"counts"`
+}
+
+// ReliabilityCurve bins the probabilities into nBins bins of equal width
+// and computes the reliability diagram data.
+func ReliabilityCurve(probs []float64, labels []float64, nBins int) Reliability {
+	sums := make([]float64, nBins)
+	pos := make([]float64, nBins)
+	counts := make([]int, nBins)
+	for i, p := range probs {
+		bin := int(p * float64(nBins))
+		if bin >= nBins {
+			bin = nBins - 1
+		} else if bin < 0 {
+			bin = 0
+		}
+		sums[bin] += p
+		if labels[i] > 0.5 {
+			pos[bin]++
+		}
+		counts[bin]++
+	}
+	var rel Reliability
+	for bin, count := range counts {
+		if count == 0 {
+			continue
+		}
+		rel.MeanPred = append(rel.MeanPred, sums[bin]/float64(count))
+		rel.FracPos = append(rel.FracPos, pos[bin]/float64(count))
+		rel.Counts = append(rel.Counts, count)
+	}
+	return rel
+}
+
+// BrierScore computes the mean squared difference between the predicted
+// probabilities and the labels (see metrics.BrierScore).
+func BrierScore(probs []float64, labels []float64) float64 {
+	return metrics.BrierScore(probs, labels)
+}
@@ -1,13 +1,21 @@
 package ch03
 
 import (
+	"encoding/gob"
 	"encoding/json"
 	"math"
 	"math/rand"
 
+	pl "grokml/pkg/pipeline"
 	vc "grokml/pkg/vector"
 )
 
+// init registers the linear regressors with gob.
+func init() {
+	gob.Register(&LinReg{})
+	gob.Register(&RegLin{})
+}
+
 // LinReg implements a linear regression engine.
 type LinReg struct {
 	Weights vc.Vector `json:"weights"`
@@ -23,17 +31,27 @@ func NewLinReg(lrate float64, epochs int) *LinReg {
 
 // Fit performs the training.
 func (lr *LinReg) Fit(dpoints []vc.Vector, labels []float64) []float64 {
+	return lr.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted performs the training with sample weights, which scale the
+// learning rate of the examples' updates. It returns the weighted root mean
+// squared errors of the epochs.
+func (lr *LinReg) FitWeighted(dpoints []vc.Vector, labels []float64, sweights []float64) []float64 {
 	weights := vc.RandVector(len(dpoints[0]))
 	bias := rand.Float64()
 	errs := make([]float64, 0, lr.NEpochs)
-	size := float64(len(dpoints))
+	var size float64
+	for _, w := range sweights {
+		size += w
+	}
 	for ep := 0; ep < lr.NEpochs; ep++ {
 		var err float64
 		for i, vec := range dpoints {
 			delta := weights.Dot(vec) + bias - labels[i]
-			weights.IAdd(vec.ScaMul(-lr.LRate * delta))
-			bias -= lr.LRate * delta
-			err += delta * delta
+			weights.IAdd(vec.ScaMul(-lr.LRate * sweights[i] * delta))
+			bias -= lr.LRate * sweights[i] * delta
+			err += sweights[i] * delta * delta
 		}
 		errs = append(errs, math.Sqrt(err/size))
 	}
@@ -53,26 +71,7 @@ func (lr LinReg) Predict(dpoints []vc.Vector) []float64 {
 
 // Score computes the coefficient of determination.
 func (lr LinReg) Score(dpoints []vc.Vector, labels []float64) float64 {
-	preds := lr.Predict(dpoints)
-	ym := mean(preds)
-	// Residual Sum of Squares, Total Sum of Squares
-	var rss, tss float64
-	for i, label := range labels {
-		// Residual Sum of Squares
-		rss += (label - preds[i]) * (label - preds[i])
-		// Total Sum of Squares
-		tss += (label - ym) * (label - ym)
-	}
-	return 1.0 - rss/tss
-}
-
-// mean is a helper function for computing the mean of a slice of floats.
-func mean(numbers []float64) float64 {
-	var m float64
-	for _, val := range numbers {
-		m += val
-	}
-	return m / float64(len(numbers))
+	return pl.GetCoD(lr.Predict(dpoints), labels)
 }
 
 // Marshal and Unmarshal implement the JSONable interface from the persist package.
@@ -0,0 +1,36 @@
+package ch03
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	vc "grokml/pkg/vector"
+)
+
+func TestLinRegScore(t *testing.T) {
+	// The predictions have mean 2.5, the labels mean 3.0.
+	lr := &LinReg{Weights: vc.Vector{1.0}, Bias: 0.0}
+	dpoints := []vc.Vector{{1}, {2}, {3}, {4}}
+	labels := []float64{2, 2, 4, 4}
+	// rss = 1 + 0 + 1 + 0, tss = 1 + 1 + 1 + 1 around the label mean
+	exp := 0.5
+	if got := lr.Score(dpoints, labels); math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected R2 score %.3f, got %.3f", exp, got)
+	}
+}
+
+func TestLinRegFitWeighted(t *testing.T) {
+	dpoints := []vc.Vector{{1}, {2}, {3}, {4}}
+	labels := []float64{2, 4, 6, 8}
+	rand.Seed(1)
+	lr := NewLinReg(0.01, 50)
+	lr.Fit(dpoints, labels)
+	// An outlier of weight zero does not change anything.
+	rand.Seed(1)
+	wlr := NewLinReg(0.01, 50)
+	wlr.FitWeighted(append(dpoints, vc.Vector{5}), append(labels, 100), []float64{1, 1, 1, 1, 0})
+	if wlr.Bias != lr.Bias || wlr.Weights[0] != lr.Weights[0] {
+		t.Errorf("expected %+v, got %+v", lr, wlr)
+	}
+}
@@ -1,14 +1,23 @@
 package ch05
 
 import (
+	"encoding/gob"
 	"encoding/json"
+	"math"
 	"math/rand"
 
 	"grokml/pkg/ch06-logreg"
+	pl "grokml/pkg/pipeline"
 	tk "grokml/pkg/tokens"
 	vc "grokml/pkg/vector"
 )
 
+// init registers both variants of Perceptron with gob.
+func init() {
+	gob.Register(&Perceptron[tk.TokenMap]{})
+	gob.Register(&Perceptron[vc.Vector]{})
+}
+
 // Perceptron implements a perceptron classifier. The weights are maintained by
 // an object that satisfies the Updater interface.
 // The weights are not held directly because their type must not be fixed
@@ -52,6 +61,13 @@ func (pc *Perceptron[D]) Unmarshal(bs []byte) error {
 
 // Fit performs the training.
 func (pc *Perceptron[D]) Fit(dpoints []D, labels []float64) []float64 {
+	return pc.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted performs the training with sample weights. An example of
+// weight w is updated in steps of weight 1 and a last one of the
+// remaining fraction, so that integer weights count like repeated examples.
+func (pc *Perceptron[D]) FitWeighted(dpoints []D, labels []float64, weights []float64) []float64 {
 	size := len(dpoints)
 	if size == 0 {
 		return nil
@@ -60,17 +76,23 @@ func (pc *Perceptron[D]) Fit(dpoints []D, labels []float64) []float64 {
 	pc.Updater.Init(len(dpoints[0]))
 	var bias float64
 	errs := make([]float64, pc.NEpochs)
-	nDPs := float64(size)
+	var nDPs float64
+	for _, w := range weights {
+		nDPs += w
+	}
 	for i := 0; i < pc.NEpochs; i++ {
 		var sum float64
 		for j, dpoint := range dpoints {
-			pred := heaviside(pc.Updater.Dot(dpoint) + bias)
-			diff := pred - labels[j]
-			if diff != 0.0 {
-				pc.Updater.Update(dpoint, -pc.LRate*diff)
-				bias -= pc.LRate * diff
-			} else {
-				sum++
+			for rest := weights[j]; rest > 0.0; rest -= 1.0 {
+				step := math.Min(rest, 1.0)
+				pred := heaviside(pc.Updater.Dot(dpoint) + bias)
+				diff := pred - labels[j]
+				if diff != 0.0 {
+					pc.Updater.Update(dpoint, -pc.LRate*step*diff)
+					bias -= pc.LRate * step * diff
+				} else {
+					sum += step
+				}
 			}
 		}
 		errs[i] = sum / nDPs
@@ -88,6 +110,32 @@ func (pc Perceptron[D]) Predict(dpoints []D) []float64 {
 	return res
 }
 
+// PredictProba squashes the perceptron output with the logistic function.
+// This gives a probability of the positive class that is consistent with the
+// Heaviside output: it is at least 0.5 whenever the perceptron predicts 1.
+func (pc Perceptron[D]) PredictProba(dpoints []D) []float64 {
+	res := make([]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		res[i] = 1.0 / (1.0 + math.Exp(-pc.Updater.Dot(dpoint)-pc.Bias))
+	}
+	return res
+}
+
+// PredictClass labels the data points whose probability reaches the threshold
+// with 1. The output is compared with the logit of the threshold rather than
+// the probability with the threshold, which rounds to 0.5 near the decision
+// boundary, so that the threshold 0.5 labels the data points like Predict.
+func (pc Perceptron[D]) PredictClass(dpoints []D, threshold float64) []float64 {
+	logit := math.Log(threshold / (1.0 - threshold))
+	res := make([]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		if pc.Updater.Dot(dpoint)+pc.Bias >= logit {
+			res[i] = 1.0
+		}
+	}
+	return res
+}
+
 // Score computes the accuracy.
 func (pc Perceptron[D]) Score(dpoints []D, labels []float64) float64 {
 	var acc float64
@@ -5,8 +5,11 @@ import (
 	"math/rand"
 	"testing"
 
+	"grokml/pkg/ch06-logreg"
 	ds "grokml/pkg/dataset"
+	pl "grokml/pkg/pipeline"
 	tk "grokml/pkg/tokens"
+	vc "grokml/pkg/vector"
 )
 
 func TestPerceptron(t *testing.T) {
@@ -30,3 +33,66 @@ func TestPerceptron(t *testing.T) {
 		t.Errorf("expected %v or %v, got %v", exp1, exp2, got)
 	}
 }
+
+func TestPerceptronPredictProba(t *testing.T) {
+	pc := NewNumPerceptron(0, 0.0)
+	pc.Updater.Init(2)
+	pc.Updater.Update(vc.Vector{1, -1}, 1.0)
+	pc.Bias = 0.5
+	// The last data point lies on the decision boundary: Dot + Bias == 0.
+	dpoints := []vc.Vector{{3, 1}, {1, 3}, {0, 0}, {-1, 2}, {1, 1.5}}
+	probs := pc.PredictProba(dpoints)
+	preds := pc.Predict(dpoints)
+	if preds[4] != 1.0 {
+		t.Errorf("expected label 1 on the decision boundary, got %v", preds[4])
+	}
+	for i, label := range pc.PredictClass(dpoints, 0.5) {
+		if probs[i] <= 0.0 || probs[i] >= 1.0 {
+			t.Errorf("data point %d: expected probability in (0, 1), got %v", i, probs[i])
+		}
+		if label != preds[i] {
+			t.Errorf("data point %d: expected label %v, got %v", i, preds[i], label)
+		}
+	}
+}
+
+func TestPerceptronFitWeighted(t *testing.T) {
+	dpoints := []vc.Vector{{1, 3}, {2, 1}, {3, 4}, {4, 1}, {1, 1}, {3, 2}}
+	labels := []float64{1, 0, 1, 0, 0, 1}
+	fit := func(dpoints []vc.Vector, labels, weights []float64) *Perceptron[vc.Vector] {
+		pc := NewNumPerceptron(10, 0.5)
+		if weights == nil {
+			pc.Fit(dpoints, labels)
+		} else {
+			pc.FitWeighted(dpoints, labels, weights)
+		}
+		return pc
+	}
+	same := func(exp, got *Perceptron[vc.Vector]) bool {
+		ew, gw := exp.Updater.(*ch06.VectorUpdater).Weights, got.Updater.(*ch06.VectorUpdater).Weights
+		return exp.Bias == got.Bias && ew[0] == gw[0] && ew[1] == gw[1]
+	}
+	// An outlier of weight zero does not change anything.
+	exp := fit(dpoints, labels, nil)
+	outPts := []vc.Vector{{1, 3}, {2, 1}, {9, -9}, {3, 4}, {4, 1}, {1, 1}, {3, 2}}
+	outLbs := []float64{1, 0, 1, 1, 0, 0, 1}
+	if got := fit(outPts, outLbs, []float64{1, 1, 0, 1, 1, 1, 1}); !same(exp, got) {
+		t.Errorf("expected %v %v, got %v %v", exp.Updater, exp.Bias, got.Updater, got.Bias)
+	}
+	// Integer weights count like repeated examples.
+	for j := range dpoints {
+		weights := pl.UnitWeights(len(dpoints))
+		weights[j] = 3
+		var repPts []vc.Vector
+		var repLbs []float64
+		for i := range dpoints {
+			for k := 0; k < int(weights[i]); k++ {
+				repPts, repLbs = append(repPts, dpoints[i]), append(repLbs, labels[i])
+			}
+		}
+		exp, got := fit(repPts, repLbs, nil), fit(dpoints, labels, weights)
+		if !same(exp, got) {
+			t.Errorf("weight 3 on example %d: expected %v %v, got %v %v", j, exp.Updater, exp.Bias, got.Updater, got.Bias)
+		}
+	}
+}
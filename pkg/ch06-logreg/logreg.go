@@ -1,14 +1,22 @@
 package ch06
 
 import (
+	"encoding/gob"
 	"encoding/json"
 	"math"
 	"math/rand"
 
+	pl "grokml/pkg/pipeline"
 	tk "grokml/pkg/tokens"
 	vc "grokml/pkg/vector"
 )
 
+// init registers both variants of LogReg with gob.
+func init() {
+	gob.Register(&LogReg[tk.TokenMap]{})
+	gob.Register(&LogReg[vc.Vector]{})
+}
+
 // LogReg implements a logistic regression engine. The weights are maintained by
 // an object that satisfies the Updater interface.
 // The weights are not held directly because their type must not be fixed
@@ -52,6 +60,13 @@ func (lr *LogReg[D]) Unmarshal(bs []byte) error {
 
 // Fit performs the training.
 func (lr *LogReg[D]) Fit(dpoints []D, labels []float64) []float64 {
+	return lr.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted performs the training with sample weights. An example of
+// weight w is updated in steps of weight 1 and a last one of the
+// remaining fraction, so that integer weights count like repeated examples.
+func (lr *LogReg[D]) FitWeighted(dpoints []D, labels []float64, weights []float64) []float64 {
 	size := len(dpoints)
 	if size == 0 {
 		return nil
@@ -60,15 +75,21 @@ func (lr *LogReg[D]) Fit(dpoints []D, labels []float64) []float64 {
 	lr.Updater.Init(len(dpoints[0]))
 	var bias float64
 	errs := make([]float64, lr.NEpochs)
-	nDPs := float64(size)
+	var nDPs float64
+	for _, w := range weights {
+		nDPs += w
+	}
 	for i := 0; i < lr.NEpochs; i++ {
 		var sum float64
 		for j, dpoint := range dpoints {
-			pred := sigmoid(lr.Updater.Dot(dpoint) + bias)
-			diff := pred - labels[j]
-			lr.Updater.Update(dpoint, -lr.LRate*diff)
-			bias -= lr.LRate * diff
-			sum += xentropy(pred, labels[j])
+			for rest := weights[j]; rest > 0.0; rest -= 1.0 {
+				step := math.Min(rest, 1.0)
+				pred := sigmoid(lr.Updater.Dot(dpoint) + bias)
+				diff := pred - labels[j]
+				lr.Updater.Update(dpoint, -lr.LRate*step*diff)
+				bias -= lr.LRate * step * diff
+				sum += step * xentropy(pred, labels[j])
+			}
 		}
 		errs[i] = sum / nDPs
 	}
@@ -78,6 +99,12 @@ func (lr *LogReg[D]) Fit(dpoints []D, labels []float64) []float64 {
 
 // Predict returns the output of the sigmoid squasher.
 func (lr LogReg[D]) Predict(dpoints []D) []float64 {
+	return lr.PredictProba(dpoints)
+}
+
+// PredictProba returns the output of the sigmoid squasher as the probability
+// of the positive class. It implements the ProbabilisticEstimator interface.
+func (lr LogReg[D]) PredictProba(dpoints []D) []float64 {
 	res := make([]float64, len(dpoints))
 	for i, dpoint := range dpoints {
 		res[i] = sigmoid(lr.Updater.Dot(dpoint) + lr.Bias)
@@ -85,6 +112,11 @@ func (lr LogReg[D]) Predict(dpoints []D) []float64 {
 	return res
 }
 
+// PredictClass labels the data points whose probability exceeds the threshold with 1.
+func (lr LogReg[D]) PredictClass(dpoints []D, threshold float64) []float64 {
+	return pl.Classify(lr.PredictProba(dpoints), threshold)
+}
+
 // Score computes the accuracy.
 func (lr LogReg[D]) Score(dpoints []D, labels []float64) float64 {
 	var acc float64
@@ -5,7 +5,9 @@ import (
 	"testing"
 
 	ds "grokml/pkg/dataset"
+	pl "grokml/pkg/pipeline"
 	tk "grokml/pkg/tokens"
+	vc "grokml/pkg/vector"
 )
 
 func TestLogReg(t *testing.T) {
@@ -28,3 +30,62 @@ func TestLogReg(t *testing.T) {
 		t.Errorf("expected %v or %v, got %v", exp1, exp2, got)
 	}
 }
+
+func TestLogRegPredictProba(t *testing.T) {
+	lr := NewNumLogReg(50, 0.5)
+	dpoints := []vc.Vector{{1, 3}, {2, 1}, {3, 4}, {4, 1}, {1, 1}, {3, 2}}
+	labels := []float64{1, 0, 1, 0, 0, 1}
+	lr.Fit(dpoints, labels)
+	// Predict returns the probabilities, which Score labels at 0.5.
+	probs := lr.PredictProba(dpoints)
+	preds := lr.Predict(dpoints)
+	for i, label := range lr.PredictClass(dpoints, 0.5) {
+		if probs[i] <= 0.0 || probs[i] >= 1.0 {
+			t.Errorf("data point %d: expected probability in (0, 1), got %v", i, probs[i])
+		}
+		if exp := pl.Classify(preds[i:i+1], 0.5)[0]; label != exp {
+			t.Errorf("data point %d: expected label %v, got %v", i, exp, label)
+		}
+	}
+}
+
+func TestLogRegFitWeighted(t *testing.T) {
+	dpoints := []vc.Vector{{1, 3}, {2, 1}, {3, 4}, {4, 1}, {1, 1}, {3, 2}}
+	labels := []float64{1, 0, 1, 0, 0, 1}
+	fit := func(dpoints []vc.Vector, labels, weights []float64) (*LogReg[vc.Vector], []float64) {
+		lr := NewNumLogReg(10, 0.5)
+		if weights == nil {
+			return lr, lr.Fit(dpoints, labels)
+		}
+		return lr, lr.FitWeighted(dpoints, labels, weights)
+	}
+	same := func(exp, got *LogReg[vc.Vector]) bool {
+		ew, gw := exp.Updater.(*VectorUpdater).Weights, got.Updater.(*VectorUpdater).Weights
+		return exp.Bias == got.Bias && ew[0] == gw[0] && ew[1] == gw[1]
+	}
+	// An outlier of weight zero does not change anything.
+	exp, expErrs := fit(dpoints, labels, nil)
+	outPts := []vc.Vector{{1, 3}, {2, 1}, {9, -9}, {3, 4}, {4, 1}, {1, 1}, {3, 2}}
+	outLbs := []float64{1, 0, 1, 1, 0, 0, 1}
+	got, gotErrs := fit(outPts, outLbs, []float64{1, 1, 0, 1, 1, 1, 1})
+	if !same(exp, got) || gotErrs[len(gotErrs)-1] != expErrs[len(expErrs)-1] {
+		t.Errorf("expected %v %v, got %v %v", exp.Updater, exp.Bias, got.Updater, got.Bias)
+	}
+	// Integer weights count like repeated examples.
+	for j := range dpoints {
+		weights := pl.UnitWeights(len(dpoints))
+		weights[j] = 3
+		var repPts []vc.Vector
+		var repLbs []float64
+		for i := range dpoints {
+			for k := 0; k < int(weights[i]); k++ {
+				repPts, repLbs = append(repPts, dpoints[i]), append(repLbs, labels[i])
+			}
+		}
+		exp, _ := fit(repPts, repLbs, nil)
+		got, _ := fit(dpoints, labels, weights)
+		if !same(exp, got) {
+			t.Errorf("weight 3 on example %d: expected %v %v, got %v %v", j, exp.Updater, exp.Bias, got.Updater, got.Bias)
+		}
+	}
+}
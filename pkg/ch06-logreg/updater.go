@@ -1,6 +1,8 @@
 package ch06
 
 import (
+	"encoding/gob"
+
 	tk "grokml/pkg/tokens"
 	vc "grokml/pkg/vector"
 )
@@ -10,6 +12,12 @@ type DataPoint interface {
 	tk.TokenMap | vc.Vector
 }
 
+// init registers the updaters with gob.
+func init() {
+	gob.Register(&VectorUpdater{})
+	gob.Register(&TokenMapUpdater{})
+}
+
 // Updater is the interface for a weight updating engine.
 type Updater[D DataPoint] interface {
 	Init(size int)
@@ -1,12 +1,18 @@
 package ch08
 
 import (
+	"encoding/gob"
 	"encoding/json"
 
 	pl "grokml/pkg/pipeline"
 	tk "grokml/pkg/tokens"
 )
 
+// init registers NaiveBayes with gob.
+func init() {
+	gob.Register(&NaiveBayes{})
+}
+
 // Count serves as a container for ham and spam counts which are assigned to
 // each word encountered during processing. We use floats to ease calculations
 // involving float division.
@@ -30,23 +36,30 @@ func NewNaiveBayes(th float64) *NaiveBayes {
 
 // Fit performs training on email documents as token maps.
 func (nb *NaiveBayes) Fit(tmaps []tk.TokenMap, labels []float64) []float64 {
-	var spam, ham int
+	return nb.FitWeighted(tmaps, labels, pl.UnitWeights(len(tmaps)))
+}
+
+// FitWeighted performs training with sample weights: the tokens of an email
+// of weight w are counted w times.
+func (nb *NaiveBayes) FitWeighted(tmaps []tk.TokenMap, labels []float64, weights []float64) []float64 {
+	var spam, ham float64
 	for i, tmap := range tmaps {
+		w := weights[i]
 		for token, _ := range tmap {
 			count, ok := nb.Vocab[token]
 			if !ok {
 				count = Count{Spam: 1.0, Ham: 1.0}
 			} else if labels[i] == 1.0 {
-				count.Spam++
-				spam++
+				count.Spam += w
+				spam += w
 			} else {
-				count.Ham++
-				ham++
+				count.Ham += w
+				ham += w
 			}
 			nb.Vocab[token] = count
 		}
 	}
-	nb.Count = Count{Ham: float64(ham), Spam: float64(spam)}
+	nb.Count = Count{Ham: ham, Spam: spam}
 	return nil
 }
 
@@ -63,15 +76,25 @@ func (nb NaiveBayes) Get(token string) Count {
 
 // Predict classifies the given emails as token maps.
 func (nb NaiveBayes) Predict(tmaps []tk.TokenMap) []float64 {
+	return nb.PredictClass(tmaps, nb.Threshold)
+}
+
+// PredictProba computes the spam probabilities of the given emails. Together
+// with PredictClass, it implements the ProbabilisticEstimator interface.
+func (nb NaiveBayes) PredictProba(tmaps []tk.TokenMap) []float64 {
 	res := make([]float64, len(tmaps))
 	for i, tmap := range tmaps {
-		if nb.Prob(tmap) > nb.Threshold {
-			res[i] = 1.0
-		}
+		res[i] = nb.Prob(tmap)
 	}
 	return res
 }
 
+// PredictClass classifies the emails as spam whose probability exceeds the
+// given threshold instead of the model's own.
+func (nb NaiveBayes) PredictClass(tmaps []tk.TokenMap, threshold float64) []float64 {
+	return pl.Classify(nb.PredictProba(tmaps), threshold)
+}
+
 // Prob computes the probability of a given email to be spam.
 // The variable 'total' guarantees computational stability and is
 // cancelled out in the end result.
@@ -1,6 +1,7 @@
 package ch08
 
 import (
+	"math"
 	"testing"
 
 	ds "grokml/pkg/dataset"
@@ -33,4 +34,34 @@ func TestNaiveBayesPredict(t *testing.T) {
 	if score != nb.report.Accuracy {
 		t.Errorf("reported accuracy %.2f != %.2f score", nb.report.Accuracy, score)
 	}
+	// Probabilities agree with Prob, classes with Predict.
+	probs := nb.PredictProba(tmaps)
+	for i, tmap := range tmaps {
+		// token maps are iterated in random order, so sums may differ in rounding
+		if math.Abs(probs[i]-nb.Prob(tmap)) > 1e-12*nb.Prob(tmap) {
+			t.Errorf("expected probability %v, got %v", nb.Prob(tmap), probs[i])
+		}
+	}
+	preds = nb.Predict(tmaps)
+	for i, label := range nb.PredictClass(tmaps, nb.Threshold) {
+		if label != preds[i] {
+			t.Errorf("expected class %v, got %v", preds[i], label)
+		}
+	}
+}
+
+func TestNaiveBayesFitWeighted(t *testing.T) {
+	tmaps := []tk.TokenMap{{"cheap": 1, "pills": 1}, {"cheap": 1, "lunch": 1}, {"team": 1, "lunch": 1}}
+	labels := []float64{1, 1, 0}
+	nb := NewNaiveBayes(0.5)
+	nb.Fit(tmaps, labels)
+	wnb := NewNaiveBayes(0.5)
+	wnb.FitWeighted(tmaps, labels, []float64{2, 2, 2})
+	// Counts beyond the initial ones double.
+	if exp := 2 * nb.Count.Spam; wnb.Count.Spam != exp {
+		t.Errorf("expected spam count %v, got %v", exp, wnb.Count.Spam)
+	}
+	if exp := 2*(nb.Vocab["lunch"].Ham-1.0) + 1.0; wnb.Vocab["lunch"].Ham != exp {
+		t.Errorf("expected ham count %v, got %v", exp, wnb.Vocab["lunch"].Ham)
+	}
 }
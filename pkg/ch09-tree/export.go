@@ -0,0 +1,258 @@
+package ch09
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// The exporters below describe a trained tree for humans: DOT renders it
+// with Graphviz, SVG without, and Rules writes it as nested if/else rules.
+// They all take the feature names of the data point components, eg the
+// header of a DataSet without the label; components without a name are
+// called x[0], x[1], ...
+
+// palette holds the colours of the classes, those of regression trees
+// being the first one.
+var palette = [][3]float64{
+	{229, 129, 57}, {57, 157, 229}, {129, 229, 57}, {229, 57, 157},
+	{157, 57, 229}, {57, 229, 157}, {229, 212, 57}, {130, 130, 130},
+}
+
+// featureName returns the name of the d-th component.
+func featureName(names []string, d int) string {
+	if d < len(names) && names[d] != "" {
+		return names[d]
+	}
+	return fmt.Sprintf("x[%d]", d)
+}
+
+// condition describes the test of a split that sends data points left.
+func condition(si SplitInfo, names []string) string {
+	name := featureName(names, si.Dimension)
+	var cond string
+	if si.Categories != nil {
+		cats := make([]string, len(si.Categories))
+		for i, cat := range si.Categories {
+			cats[i] = fmt.Sprintf("%g", cat)
+		}
+		cond = fmt.Sprintf("%s in {%s}", name, strings.Join(cats, ", "))
+	} else {
+		cond = fmt.Sprintf("%s < %.4g", name, si.Threshold)
+	}
+	if si.MissingLeft {
+		cond += " or missing"
+	}
+	return cond
+}
+
+// value describes the prediction of a node: the class distribution of
+// classification trees, the label of regression trees.
+func value(nd *Node) string {
+	if nd.Dist == nil {
+		return fmt.Sprintf("value = %.4g", nd.Label)
+	}
+	probs := make([]string, len(nd.Dist))
+	for k, p := range nd.Dist {
+		probs[k] = fmt.Sprintf("%.2f", p)
+	}
+	return fmt.Sprintf("dist = [%s]", strings.Join(probs, ", "))
+}
+
+// describe returns the lines of text that describe a node.
+func describe(nd *Node, names []string) []string {
+	var lines []string
+	if nd.Left != nil {
+		lines = append(lines, condition(nd.Split, names))
+	}
+	lines = append(lines, fmt.Sprintf("samples = %d", nd.Samples), value(nd))
+	if nd.Dist != nil {
+		lines = append(lines, fmt.Sprintf("class = %d", Argmax(nd.Dist)))
+	}
+	return lines
+}
+
+// labelRange is a helper function that finds the least and greatest label
+// of the nodes below nd, by which regression trees are coloured.
+func labelRange(nd *Node) (float64, float64) {
+	lo, hi := nd.Label, nd.Label
+	if nd.Left != nil {
+		for _, child := range []*Node{nd.Left, nd.Right} {
+			clo, chi := labelRange(child)
+			lo, hi = math.Min(lo, clo), math.Max(hi, chi)
+		}
+	}
+	return lo, hi
+}
+
+// colour returns the fill colour of a node: the colour of its majority
+// class, the paler the less pure the node is, or for regression trees the
+// colour of the first class, the paler the lower the label.
+func colour(nd *Node, lo, hi float64) string {
+	var rgb [3]float64
+	var alpha float64
+	if nd.Dist != nil {
+		k := Argmax(nd.Dist)
+		rgb = palette[k%len(palette)]
+		uniform := 1.0 / float64(len(nd.Dist))
+		alpha = (nd.Dist[k] - uniform) / (1.0 - uniform)
+	} else {
+		rgb = palette[0]
+		if hi > lo {
+			alpha = (nd.Label - lo) / (hi - lo)
+		}
+	}
+	alpha = math.Max(0.0, math.Min(1.0, alpha))
+	var hex string
+	for _, c := range rgb {
+		hex += fmt.Sprintf("%02x", int(math.Round(255.0-alpha*(255.0-c))))
+	}
+	return "#" + hex
+}
+
+// DOT exports the tree in the Graphviz DOT language, eg to be rendered with
+// "dot -Tpng tree.dot -o tree.png". The nodes show their split, number of
+// training examples and prediction and are coloured by it.
+func (dt Tree) DOT(names []string) string {
+	var sb strings.Builder
+	sb.WriteString("digraph Tree {\n")
+	sb.WriteString("    node [shape=box, style=\"filled, rounded\", fontname=\"helvetica\"];\n")
+	sb.WriteString("    edge [fontname=\"helvetica\"];\n")
+	if dt.Root != nil {
+		lo, hi := labelRange(dt.Root)
+		var id int
+		var walk func(nd *Node) int
+		walk = func(nd *Node) int {
+			self := id
+			id++
+			// %q escapes quotes and turns the line breaks into \n for DOT
+			label := strings.Join(describe(nd, names), "\n")
+			fmt.Fprintf(&sb, "    %d [label=%q, fillcolor=%q];\n", self, label, colour(nd, lo, hi))
+			if nd.Left != nil {
+				left := walk(nd.Left)
+				fmt.Fprintf(&sb, "    %d -> %d [label=\"yes\"];\n", self, left)
+				right := walk(nd.Right)
+				fmt.Fprintf(&sb, "    %d -> %d [label=\"no\"];\n", self, right)
+			}
+			return self
+		}
+		walk(dt.Root)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Rules exports the tree as nested if/else rules, one leaf per prediction.
+func (dt Tree) Rules(names []string) string {
+	var sb strings.Builder
+	var walk func(nd *Node, indent string)
+	walk = func(nd *Node, indent string) {
+		if nd.Left == nil {
+			fmt.Fprintf(&sb, "%s%s (samples = %d)\n", indent, prediction(nd), nd.Samples)
+			return
+		}
+		fmt.Fprintf(&sb, "%sif %s {\n", indent, condition(nd.Split, names))
+		walk(nd.Left, indent+"    ")
+		fmt.Fprintf(&sb, "%s} else {\n", indent)
+		walk(nd.Right, indent+"    ")
+		fmt.Fprintf(&sb, "%s}\n", indent)
+	}
+	if dt.Root != nil {
+		walk(dt.Root, "")
+	}
+	return sb.String()
+}
+
+// prediction describes the prediction of a leaf for Rules.
+func prediction(nd *Node) string {
+	if nd.Dist == nil {
+		return fmt.Sprintf("predict %.4g", nd.Label)
+	}
+	k := Argmax(nd.Dist)
+	return fmt.Sprintf("predict class %d (p = %.2f)", k, nd.Dist[k])
+}
+
+// Layout of the SVG export in pixels.
+const (
+	boxWidth   = 170.0
+	lineHeight = 15.0
+	boxGap     = 20.0
+	levelGap   = 40.0
+)
+
+// SVG renders the tree as an SVG image like DOT, but without Graphviz. The
+// leaves are laid out from left to right and every inner node is centred
+// above its children.
+func (dt Tree) SVG(names []string) string {
+	if dt.Root == nil {
+		return "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"0\" height=\"0\"></svg>\n"
+	}
+	lo, hi := labelRange(dt.Root)
+	// box height of the node with the most lines
+	maxLines, maxDepth := 0, 0
+	var measure func(nd *Node)
+	measure = func(nd *Node) {
+		if n := len(describe(nd, names)); n > maxLines {
+			maxLines = n
+		}
+		if nd.Depth > maxDepth {
+			maxDepth = nd.Depth
+		}
+		if nd.Left != nil {
+			measure(nd.Left)
+			measure(nd.Right)
+		}
+	}
+	measure(dt.Root)
+	boxHeight := float64(maxLines)*lineHeight + 10.0
+	// x positions: leaves in order, inner nodes centred
+	xs := map[*Node]float64{}
+	var nLeaves int
+	var place func(nd *Node) float64
+	place = func(nd *Node) float64 {
+		if nd.Left == nil {
+			xs[nd] = float64(nLeaves)*(boxWidth+boxGap) + boxGap + boxWidth/2.0
+			nLeaves++
+		} else {
+			xs[nd] = (place(nd.Left) + place(nd.Right)) / 2.0
+		}
+		return xs[nd]
+	}
+	place(dt.Root)
+	y := func(nd *Node) float64 {
+		return float64(nd.Depth)*(boxHeight+levelGap) + boxGap
+	}
+	width := float64(nLeaves)*(boxWidth+boxGap) + boxGap
+	height := float64(maxDepth+1)*(boxHeight+levelGap) - levelGap + 2.0*boxGap
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" font-family=\"helvetica\" font-size=\"12\">\n", width, height)
+	var draw func(nd *Node)
+	draw = func(nd *Node) {
+		x, top := xs[nd], y(nd)
+		if nd.Left != nil {
+			for i, child := range []*Node{nd.Left, nd.Right} {
+				fmt.Fprintf(&sb, "  <line x1=\"%.1f\" y1=\"%.1f\" x2=\"%.1f\" y2=\"%.1f\" stroke=\"black\"/>\n",
+					x, top+boxHeight, xs[child], y(child))
+				mx, my := (x+xs[child])/2.0, (top+boxHeight+y(child))/2.0
+				fmt.Fprintf(&sb, "  <text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n",
+					mx, my, []string{"yes", "no"}[i])
+				draw(child)
+			}
+		}
+		fmt.Fprintf(&sb, "  <rect x=\"%.1f\" y=\"%.1f\" width=\"%.0f\" height=\"%.1f\" rx=\"6\" fill=\"%s\" stroke=\"black\"/>\n",
+			x-boxWidth/2.0, top, boxWidth, boxHeight, colour(nd, lo, hi))
+		for i, line := range describe(nd, names) {
+			fmt.Fprintf(&sb, "  <text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n",
+				x, top+float64(i+1)*lineHeight+2.0, escape(line))
+		}
+	}
+	draw(dt.Root)
+	sb.WriteString("</svg>\n")
+	return sb.String()
+}
+
+// escape is a helper function that escapes text for XML.
+func escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;").Replace(text)
+}
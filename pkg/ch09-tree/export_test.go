@@ -0,0 +1,45 @@
+package ch09
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	dpoints := [][]float64{{1, 0}, {2, 1}, {3, 0}, {4, 1}, {5, 0}, {6, 1}}
+	labels := []float64{0, 0, 0, 1, 1, 1}
+	names := []string{"size", "colour"}
+
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Fit(dpoints, labels)
+
+	dot := dt.DOT(names)
+	for _, want := range []string{"digraph Tree {", `0 [label="size < 3.5\nsamples = 6\ndist = [0.50, 0.50]`, "0 -> 1", "0 -> 2", "fillcolor="} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("expected DOT to contain %q, got\n%s", want, dot)
+		}
+	}
+	// The pure leaves have the full colours of their classes.
+	if !strings.Contains(dot, `fillcolor="#e58139"`) || !strings.Contains(dot, `fillcolor="#399de5"`) {
+		t.Errorf("expected class colours, got\n%s", dot)
+	}
+
+	rules := dt.Rules(nil)
+	exp := "if x[0] < 3.5 {\n" +
+		"    predict class 0 (p = 1.00) (samples = 3)\n" +
+		"} else {\n" +
+		"    predict class 1 (p = 1.00) (samples = 3)\n" +
+		"}\n"
+	if rules != exp {
+		t.Errorf("expected rules\n%s\ngot\n%s", exp, rules)
+	}
+
+	svg := dt.SVG(names)
+	if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+		t.Errorf("expected well-formed SVG, got %v", err)
+	}
+	if strings.Count(svg, "<rect") != 3 || !strings.Contains(svg, "size &lt; 3.5") {
+		t.Errorf("expected 3 boxes and the escaped split, got\n%s", svg)
+	}
+}
@@ -0,0 +1,41 @@
+package ch09
+
+// ExtraTreesClassifier implements an extremely randomized trees classifier.
+// Unlike a random forest, its trees are trained on all examples and every
+// split tries a single random threshold per candidate dimension instead of
+// all split points (see Tree.RandomSplits). This makes them much faster to
+// train, and the extra randomness often generalises better on noisy data.
+// Setting Bootstrap brings back bootstrap samples and out-of-bag scores.
+type ExtraTreesClassifier struct {
+	ForestClassifier
+}
+
+// NewExtraTreesClassifier is the constructor function for ExtraTreesClassifier.
+// Its parameters are the number of trees, the impurity and the minimum gain.
+// Every split searches the square root of the number of dimensions.
+func NewExtraTreesClassifier(nTrees int, imp Impurity, ming float64) *ExtraTreesClassifier {
+	fc := NewForestClassifier(nTrees, imp, ming)
+	fc.Bootstrap = false
+	for _, tree := range fc.Estimators {
+		tree.RandomSplits = true
+	}
+	return &ExtraTreesClassifier{*fc}
+}
+
+// ExtraTreesRegressor implements extremely randomized regression trees,
+// whose predictions are averaged (see ExtraTreesClassifier).
+type ExtraTreesRegressor struct {
+	ForestRegressor
+}
+
+// NewExtraTreesRegressor is the constructor function for ExtraTreesRegressor.
+// Its parameters are the number of trees and the minimum gain. Every split
+// searches all dimensions.
+func NewExtraTreesRegressor(nTrees int, ming float64) *ExtraTreesRegressor {
+	fr := NewForestRegressor(nTrees, ming)
+	fr.Bootstrap = false
+	for _, tree := range fr.Estimators {
+		tree.RandomSplits = true
+	}
+	return &ExtraTreesRegressor{*fr}
+}
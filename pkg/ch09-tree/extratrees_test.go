@@ -0,0 +1,58 @@
+package ch09
+
+import (
+	"math"
+	"testing"
+
+	"grokml/pkg/persist"
+)
+
+func TestExtraTreesClassifier(t *testing.T) {
+	dpoints := [][]float64{
+		{1, 1}, {2, 1}, {1, 2}, {2, 2}, {1, 3}, {2, 3},
+		{8, 1}, {9, 1}, {8, 2}, {9, 2}, {8, 3}, {9, 3},
+		{5, 8}, {6, 8}, {5, 9}, {6, 9}, {5, 7}, {6, 7},
+	}
+	labels := []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2}
+
+	ec := NewExtraTreesClassifier(10, Gini, 0.0)
+	ec.Seed = 5
+	ec.Fit(dpoints, labels)
+	if acc := ec.Score(dpoints, labels); acc != 1.0 {
+		t.Errorf("expected accuracy 1, got %.4f", acc)
+	}
+	// The thresholds are random rather than midpoints between components.
+	var random bool
+	for _, tree := range ec.Estimators {
+		thr := tree.Root.Split.Threshold
+		if thr != math.Floor(thr)+0.5 {
+			random = true
+		}
+	}
+	if !random {
+		t.Error("expected random thresholds")
+	}
+	persist.Dump(ec, "../../models/ch09-tree/extratrees.json")
+
+	ec2 := &ExtraTreesClassifier{}
+	persist.Load(ec2, "../../models/ch09-tree/extratrees.json")
+	if acc := ec2.Score(dpoints, labels); acc != 1.0 {
+		t.Errorf("expected accuracy 1 after loading, got %.4f", acc)
+	}
+}
+
+func TestExtraTreesRegressor(t *testing.T) {
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 40; i++ {
+		x := float64(i) / 4.0
+		dpoints = append(dpoints, []float64{x, float64(i % 3)})
+		labels = append(labels, x*x)
+	}
+
+	er := NewExtraTreesRegressor(10, 0.0)
+	er.Fit(dpoints, labels)
+	if r2 := er.Score(dpoints, labels); r2 < 0.95 {
+		t.Errorf("expected R2 of at least 0.95, got %.4f", r2)
+	}
+}
@@ -0,0 +1,279 @@
+package ch09
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// FlatNode is a node of a FlatTree. Inner nodes hold the split dimension
+// Feature and the indices of their children; leaves have Feature -1.
+// Categorical splits refer to their categories by the index Categories
+// into the categories of the tree, threshold splits have Categories -1.
+// Value is the label of the node.
+type FlatNode struct {
+	Feature     int32   `json:"feature"`
+	Left        int32   `json:"left"`
+	Right       int32   `json:"right"`
+	Categories  int32   `json:"categories"`
+	MissingLeft bool    `json:"missing_left,omitempty"`
+	Threshold   float64 `json:"threshold"`
+	Value       float64 `json:"value"`
+}
+
+// FlatTree is the compiled form of a tree for fast inference: its nodes lie
+// in one contiguous array in preorder, the root first and every parent
+// before its children, so that prediction walks an array instead of chasing
+// pointers. The class distributions of classification trees are stored
+// back to back in Dists, Classes values per node. The remaining node
+// attributes are kept in arrays of their own, which prediction does not
+// touch, so that the nodes lose nothing in the conversion back to the
+// pointer tree. The settings of the tree, such as its limits, and its
+// importances are not kept. Since the arrays do not nest, FlatTree persists
+// trees of any depth.
+type FlatTree struct {
+	Nodes      []FlatNode  `json:"nodes"`
+	Categories [][]float64 `json:"categories,omitempty"`
+	Classes    int         `json:"classes,omitempty"`
+	Dists      []float64   `json:"dists,omitempty"`
+	Samples    []int       `json:"samples"`
+	Impurities []float64   `json:"impurities"`
+	Weights    []float64   `json:"weights"`
+	MinGains   []float64   `json:"min_gains"`
+}
+
+// Flatten compiles the tree into a FlatTree. It walks the tree with an
+// explicit stack, so deep trees cannot exhaust the call stack.
+func (dt Tree) Flatten() *FlatTree {
+	ft := &FlatTree{}
+	if dt.Root == nil {
+		return ft
+	}
+	if dt.Root.Dist != nil {
+		ft.Classes = len(dt.Root.Dist)
+	}
+	n := size(dt.Root)
+	ft.Nodes = make([]FlatNode, 0, n)
+	ft.Dists = make([]float64, 0, n*ft.Classes)
+	ft.Samples = make([]int, 0, n)
+	ft.Impurities = make([]float64, 0, n)
+	ft.Weights = make([]float64, 0, n)
+	ft.MinGains = make([]float64, 0, n)
+	type entry struct {
+		nd     *Node
+		parent int32
+		left   bool
+	}
+	stack := []entry{{nd: dt.Root, parent: -1}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		i := int32(len(ft.Nodes))
+		if e.parent >= 0 {
+			if e.left {
+				ft.Nodes[e.parent].Left = i
+			} else {
+				ft.Nodes[e.parent].Right = i
+			}
+		}
+		ft.add(e.nd)
+		if e.nd.Left != nil {
+			// the left child is popped first and thus follows its parent
+			stack = append(stack, entry{e.nd.Right, i, false}, entry{e.nd.Left, i, true})
+		}
+	}
+	return ft
+}
+
+// size is a helper function that counts the nodes of the tree below nd.
+func size(nd *Node) int {
+	var n int
+	stack := []*Node{nd}
+	for len(stack) > 0 {
+		nd, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		n++
+		if nd.Left != nil {
+			stack = append(stack, nd.Left, nd.Right)
+		}
+	}
+	return n
+}
+
+// add is a helper method that appends a node without its children.
+func (ft *FlatTree) add(nd *Node) {
+	fn := FlatNode{Feature: -1, Left: -1, Right: -1, Categories: -1, Value: nd.Label}
+	if nd.Left != nil {
+		fn.Feature = int32(nd.Split.Dimension)
+		fn.Threshold = nd.Split.Threshold
+		fn.MissingLeft = nd.Split.MissingLeft
+		if nd.Split.Categories != nil {
+			fn.Categories = int32(len(ft.Categories))
+			ft.Categories = append(ft.Categories, nd.Split.Categories)
+		}
+	}
+	ft.Nodes = append(ft.Nodes, fn)
+	if ft.Classes > 0 {
+		at := len(ft.Dists)
+		ft.Dists = append(ft.Dists, make([]float64, ft.Classes)...)
+		copy(ft.Dists[at:], nd.Dist)
+	}
+	ft.Samples = append(ft.Samples, nd.Samples)
+	ft.Impurities = append(ft.Impurities, nd.Impurity)
+	ft.Weights = append(ft.Weights, nd.Weight)
+	ft.MinGains = append(ft.MinGains, nd.MinGain)
+}
+
+// Unflatten converts the FlatTree back into a pointer tree, which holds the
+// nodes and the number of classes.
+func (ft *FlatTree) Unflatten() Tree {
+	if len(ft.Nodes) == 0 {
+		return Tree{}
+	}
+	nodes := make([]*Node, len(ft.Nodes))
+	for i, fn := range ft.Nodes {
+		nd := &Node{
+			Label:    fn.Value,
+			Samples:  ft.Samples[i],
+			Impurity: ft.Impurities[i],
+			Weight:   ft.Weights[i],
+			MinGain:  ft.MinGains[i],
+		}
+		if ft.Classes > 0 {
+			nd.Dist = ft.dist(int32(i))
+		}
+		nodes[i] = nd
+	}
+	// parents come before their children
+	for i, fn := range ft.Nodes {
+		if fn.Feature < 0 {
+			continue
+		}
+		nd := nodes[i]
+		nd.Split = SplitInfo{Dimension: int(fn.Feature), Threshold: fn.Threshold, MissingLeft: fn.MissingLeft}
+		if fn.Categories >= 0 {
+			nd.Split.Categories = ft.Categories[fn.Categories]
+		}
+		nd.Left, nd.Right = nodes[fn.Left], nodes[fn.Right]
+		nd.Left.Depth, nd.Right.Depth = nd.Depth+1, nd.Depth+1
+	}
+	return Tree{Root: nodes[0], Classes: ft.Classes}
+}
+
+// leaf returns the index of the leaf reached by the data point.
+func (ft *FlatTree) leaf(dpoint []float64) int32 {
+	nodes := ft.Nodes
+	var i int32
+	for {
+		fn := &nodes[i]
+		if fn.Feature < 0 {
+			return i
+		}
+		val := dpoint[fn.Feature]
+		var left bool
+		switch {
+		case math.IsNaN(val):
+			left = fn.MissingLeft
+		case fn.Categories >= 0:
+			for _, cat := range ft.Categories[fn.Categories] {
+				if val == cat {
+					left = true
+					break
+				}
+			}
+		default:
+			left = val < fn.Threshold
+		}
+		if left {
+			i = fn.Left
+		} else {
+			i = fn.Right
+		}
+	}
+}
+
+// dist returns the class distribution of the i-th node. Nodes of binary
+// trees trained without class distributions derive it from the label.
+func (ft *FlatTree) dist(i int32) []float64 {
+	if ft.Classes == 0 {
+		label := ft.Nodes[i].Value
+		return []float64{1.0 - label, label}
+	}
+	at := int(i) * ft.Classes
+	return ft.Dists[at : at+ft.Classes : at+ft.Classes]
+}
+
+// Apply returns the indices of the leaves reached by the data points.
+func (ft *FlatTree) Apply(dpoints [][]float64) []int {
+	leaves := make([]int, len(dpoints))
+	for i, dpoint := range dpoints {
+		leaves[i] = int(ft.leaf(dpoint))
+	}
+	return leaves
+}
+
+// Predict returns the labels of the leaves reached by the data points like
+// Tree.Predict.
+func (ft *FlatTree) Predict(dpoints [][]float64) []float64 {
+	labels := make([]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		labels[i] = ft.Nodes[ft.leaf(dpoint)].Value
+	}
+	return labels
+}
+
+// Classify returns the majority classes of the leaves reached by the data
+// points like TreeClassifier.Predict.
+func (ft *FlatTree) Classify(dpoints [][]float64) []float64 {
+	labels := make([]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		labels[i] = float64(Argmax(ft.dist(ft.leaf(dpoint))))
+	}
+	return labels
+}
+
+// PredictDist returns the class distributions of the leaves reached by the
+// data points like TreeClassifier.PredictDist.
+func (ft *FlatTree) PredictDist(dpoints [][]float64) [][]float64 {
+	dists := make([][]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		dists[i] = ft.dist(ft.leaf(dpoint))
+	}
+	return dists
+}
+
+// Marshal and Unmarshal implement the JSONable interface (pkg: persist).
+func (ft FlatTree) Marshal() ([]byte, error) {
+	return json.MarshalIndent(ft, "", "    ")
+}
+
+func (ft *FlatTree) Unmarshal(bs []byte) error {
+	if err := json.Unmarshal(bs, ft); err != nil {
+		return err
+	}
+	return ft.validate()
+}
+
+// validate is a helper method that checks the arrays of a decoded tree:
+// their lengths, the categories referred to and the children of the inner
+// nodes, which must follow their parents so that every walk ends in a leaf.
+func (ft *FlatTree) validate() error {
+	n := len(ft.Nodes)
+	if len(ft.Samples) != n || len(ft.Impurities) != n || len(ft.Weights) != n || len(ft.MinGains) != n {
+		return fmt.Errorf("flat tree: node attributes do not match %d nodes", n)
+	}
+	if ft.Classes < 0 || len(ft.Dists) != n*ft.Classes {
+		return fmt.Errorf("flat tree: %d distribution values do not match %d nodes of %d classes", len(ft.Dists), n, ft.Classes)
+	}
+	for i, fn := range ft.Nodes {
+		if fn.Feature < 0 {
+			continue
+		}
+		if fn.Left <= int32(i) || fn.Left >= int32(n) || fn.Right <= int32(i) || fn.Right >= int32(n) {
+			return fmt.Errorf("flat tree: node %d has invalid children %d and %d", i, fn.Left, fn.Right)
+		}
+		if fn.Categories < -1 || fn.Categories >= int32(len(ft.Categories)) {
+			return fmt.Errorf("flat tree: node %d has invalid categories %d", i, fn.Categories)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package ch09
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+
+	ds "grokml/pkg/dataset"
+)
+
+func TestFlatTree(t *testing.T) {
+	csv := ds.NewCSVReader("../../data/titanic.csv", "Survived")
+	dset := ds.NewDataSet(csv, ds.AtoF)
+	dpoints, labels := dset.DPoints(), dset.Labels()
+	// Missing fares and numbers of siblings, which are categorical.
+	for i := 0; i < 40; i += 2 {
+		dpoint := append([]float64(nil), dpoints[i]...)
+		dpoint[i%4/2*2] = math.NaN()
+		dpoints = append(dpoints, dpoint)
+		labels = append(labels, labels[i])
+	}
+	categorical := make([]bool, len(dpoints[0]))
+	categorical[0] = true
+
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Categorical = categorical
+	dt.Fit(dpoints, labels)
+	ft := dt.Flatten()
+	if len(ft.Nodes) != 2*len(leaves(dt.Root))-1 {
+		t.Errorf("expected %d nodes, got %d", 2*len(leaves(dt.Root))-1, len(ft.Nodes))
+	}
+	exp, got := dt.Predict(dpoints), ft.Classify(dpoints)
+	dists := ft.PredictDist(dpoints)
+	for i, dist := range dt.PredictDist(dpoints) {
+		if got[i] != exp[i] || dists[i][1] != dist[1] {
+			t.Errorf("data point %d: expected %v %v, got %v %v", i, exp[i], dist, got[i], dists[i])
+		}
+	}
+	// The nodes lose nothing in the conversion back to the pointer tree.
+	want, _ := json.Marshal(dt.Root)
+	have, _ := json.Marshal(ft.Unflatten().Root)
+	if string(have) != string(want) {
+		t.Error("round trip changed the tree")
+	}
+	// Corrupt files are rejected instead of looping or indexing out of range.
+	corrupt := []func(ft *FlatTree){
+		func(ft *FlatTree) { ft.Nodes[0].Left = 0 },
+		func(ft *FlatTree) { ft.Nodes[0].Right = int32(len(ft.Nodes)) },
+		func(ft *FlatTree) { ft.Nodes[0].Categories = int32(len(ft.Categories)) },
+		func(ft *FlatTree) { ft.Samples = ft.Samples[1:] },
+		func(ft *FlatTree) { ft.Dists = ft.Dists[1:] },
+	}
+	for c, fn := range corrupt {
+		bad := dt.Flatten()
+		fn(bad)
+		bs, _ := bad.Marshal()
+		if err := (&FlatTree{}).Unmarshal(bs); err == nil {
+			t.Errorf("corruption %d: expected an error", c)
+		}
+	}
+	bs, _ := ft.Marshal()
+	if err := (&FlatTree{}).Unmarshal(bs); err != nil {
+		t.Errorf("expected a valid tree, got %v", err)
+	}
+
+	reg := NewTreeRegressor(0.0)
+	reg.Fit(dpoints, labels)
+	for i, pred := range reg.Flatten().Predict(dpoints) {
+		if exp := reg.Predict(dpoints[i : i+1])[0]; pred != exp {
+			t.Errorf("data point %d: expected %v, got %v", i, exp, pred)
+		}
+	}
+}
+
+func TestFlatTreeDeep(t *testing.T) {
+	// A chain of 20000 splits, deeper than encoding/json nests.
+	depth := 20000
+	root := NewNode(0, 0.0)
+	nd := root
+	for d := 0; d < depth; d++ {
+		nd.Split = SplitInfo{Threshold: float64(d)}
+		nd.Left, nd.Right = &Node{Label: float64(d), Depth: d + 1}, &Node{Depth: d + 1}
+		nd = nd.Right
+	}
+	nd.Label = float64(depth)
+	bs, err := Tree{Root: root}.Flatten().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := &FlatTree{}
+	if err := ft.Unmarshal(bs); err != nil {
+		t.Fatal(err)
+	}
+	dt := ft.Unflatten()
+	dpoints := [][]float64{{-1}, {12345.5}, {float64(depth)}}
+	exp := []float64{0, 12346, float64(depth)}
+	for i, pred := range ft.Predict(dpoints) {
+		if pred != exp[i] || dt.Predict(dpoints)[i] != exp[i] {
+			t.Errorf("data point %d: expected %v, got %v", i, exp[i], pred)
+		}
+	}
+}
+
+// bigForest is a helper function that trains a forest of deep regression
+// trees for the benchmarks, which do not fit into the CPU caches.
+func bigForest(b *testing.B) (*ForestRegressor, [][]float64) {
+	rng := rand.New(rand.NewSource(1))
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 10000; i++ {
+		dpoint := []float64{rng.Float64(), rng.Float64(), rng.Float64(), rng.Float64()}
+		dpoints = append(dpoints, dpoint)
+		labels = append(labels, dpoint[0]*dpoint[1]+rng.NormFloat64())
+	}
+	fr := NewForestRegressor(20, 0.0)
+	fr.NJobs = -1
+	fr.Fit(dpoints, labels)
+	fr.NJobs = 0
+	b.ResetTimer()
+	return fr, dpoints
+}
+
+func BenchmarkForestPredictFlat(b *testing.B) {
+	fr, dpoints := bigForest(b)
+	for i := 0; i < b.N; i++ {
+		fr.Predict(dpoints)
+	}
+}
+
+func BenchmarkForestPredictPointer(b *testing.B) {
+	fr, dpoints := bigForest(b)
+	fr.flat = nil // poll the pointer trees
+	for i := 0; i < b.N; i++ {
+		fr.Predict(dpoints)
+	}
+}
+
+func BenchmarkFlatten(b *testing.B) {
+	fr, _ := bigForest(b)
+	for i := 0; i < b.N; i++ {
+		fr.Compile()
+	}
+}
@@ -2,69 +2,465 @@ package ch09
 
 import (
 	"encoding/json"
+	"math"
 	"math/rand"
 
 	pl "grokml/pkg/pipeline"
 )
 
-// Forest implements a collection of tree classifiers. Its methods are
-// promoted by the structs that embed it.
+// Forest implements a collection of tree classifiers and their votes. Its
+// methods are promoted by the structs that embed it, which train the trees.
+// NJobs is the number of goroutines training and polling the trees (see
+// pipeline.Parallel). The trees are polled in their compiled form (see
+// Compile).
 type Forest struct {
 	Size       int               `json:"size"`
+	Classes    int               `json:"classes,omitempty"`
 	Estimators []*TreeClassifier `json:"trees"`
+	NJobs      int               `json:"n_jobs,omitempty"`
 	Report     pl.Report         `json:"-"`
+	flat       []*FlatTree
 }
 
-// ForestClassifier is the basic Forest classifier.
+// Compile compiles the trees to flat trees, which predict batches of data
+// points faster (see FlatTree). Training and Unmarshal compile the trees;
+// after changing them, eg pruning them, Compile must be called again.
+func (f *Forest) Compile() {
+	f.flat = make([]*FlatTree, len(f.Estimators))
+	pl.Parallel(f.NJobs, len(f.Estimators), func(t int) {
+		f.flat[t] = f.Estimators[t].Flatten()
+	})
+}
+
+// PredictTree returns the classes predicted by the t-th tree, compiled
+// unless the trees have not been compiled, eg when the forest was decoded
+// from gob.
+func (f *Forest) PredictTree(t int, dpoints [][]float64) []float64 {
+	if len(f.flat) == len(f.Estimators) {
+		return f.flat[t].Classify(dpoints)
+	}
+	return f.Estimators[t].Predict(dpoints)
+}
+
+// PredictTreeDist returns the class distributions predicted by the t-th
+// tree like PredictTree.
+func (f *Forest) PredictTreeDist(t int, dpoints [][]float64) [][]float64 {
+	if len(f.flat) == len(f.Estimators) {
+		return f.flat[t].PredictDist(dpoints)
+	}
+	return f.Estimators[t].PredictDist(dpoints)
+}
+
+// Bagging holds the settings of random forests. With Bootstrap, every tree is
+// trained on as many examples as there are, drawn with replacement; otherwise
+// on all of them. Every split of a tree searches MaxFeatures of the dimensions
+// (see NumFeatures), eg "sqrt" as for classification, and more of them only if
+// none of these splits the node. The random seed Seed makes the forest
+// reproducible: the samples and the seeds of the trees are drawn from it
+// before the trees are trained, so the forest does not depend on the number of
+// goroutines training them. OOBScore is the score of the out-of-bag
+// predictions, ie of the predictions of every training example by the trees
+// that did not see it. It is computed with Bootstrap.
+type Bagging struct {
+	Bootstrap   bool    `json:"bootstrap"`
+	MaxFeatures string  `json:"max_features"`
+	Seed        int64   `json:"seed"`
+	OOBScore    float64 `json:"oob_score"`
+}
+
+// draws is a helper method that draws the seeds of size trees and the
+// counts of their examples.
+func (b *Bagging) draws(size, n int) ([]int64, [][]float64) {
+	rng := rand.New(rand.NewSource(b.Seed))
+	seeds := make([]int64, size)
+	counts := make([][]float64, size)
+	for t := range seeds {
+		seeds[t] = rng.Int63()
+		counts[t] = b.draw(rng, n)
+	}
+	return seeds, counts
+}
+
+// draw is a helper method that counts how often each of n examples is drawn
+// for a tree.
+func (b *Bagging) draw(rng *rand.Rand, n int) []float64 {
+	counts := make([]float64, n)
+	if !b.Bootstrap {
+		for i := range counts {
+			counts[i] = 1.0
+		}
+		return counts
+	}
+	for i := 0; i < n; i++ {
+		counts[rng.Intn(n)]++
+	}
+	return counts
+}
+
+// inBag is a helper function that collects the examples drawn for a tree.
+// An example drawn several times appears once with its weight multiplied by
+// the count. The caller's slices are left untouched.
+func inBag(counts []float64, dpoints [][]float64, labels, weights []float64) ([][]float64, []float64, []float64) {
+	var bagPoints [][]float64
+	var bagLabels, bagWeights []float64
+	for i, count := range counts {
+		if count > 0.0 {
+			bagPoints = append(bagPoints, dpoints[i])
+			bagLabels = append(bagLabels, labels[i])
+			bagWeights = append(bagWeights, count*weights[i])
+		}
+	}
+	return bagPoints, bagLabels, bagWeights
+}
+
+// outOfBag is a helper function that collects the data points not drawn
+// for a tree and their indices.
+func outOfBag(counts []float64, dpoints [][]float64) ([][]float64, []int) {
+	var oobPoints [][]float64
+	var idx []int
+	for i, count := range counts {
+		if count == 0.0 {
+			oobPoints = append(oobPoints, dpoints[i])
+			idx = append(idx, i)
+		}
+	}
+	return oobPoints, idx
+}
+
+// ForestClassifier implements a random forest classifier: its trees are
+// trained on bootstrap samples of the examples and search random subsets of
+// the dimensions for every split (see Bagging). After training, OOBDist
+// holds the out-of-bag class distributions of the training examples (nil
+// for examples seen by all trees) and OOBScore their accuracy.
 type ForestClassifier struct {
 	Forest
+	Bagging
+	OOBDist [][]float64 `json:"-"`
 }
 
 // NewForestClassifier is the constructor function for ForestClassifier.
 // Its parameters are the number of trees, the impurity and the minimum gain.
+// Trees are trained on bootstrap samples and search the square root of the
+// number of dimensions for every split.
 func NewForestClassifier(nTrees int, imp Impurity, ming float64) *ForestClassifier {
 	trees := make([]*TreeClassifier, nTrees)
 	for i, _ := range trees {
 		clf := NewTreeClassifier(imp, ming)
 		trees[i] = &clf
 	}
-	return &ForestClassifier{Forest{Size: nTrees, Estimators: trees}}
+	return &ForestClassifier{
+		Forest:  Forest{Size: nTrees, Estimators: trees},
+		Bagging: Bagging{Bootstrap: true, MaxFeatures: "sqrt"},
+	}
 }
 
 // Fit implements the training for the trees of the forest.
-func (f *Forest) Fit(dpoints [][]float64, labels []float64) {
-	chunkSize := int(0.9 * float64(len(dpoints)))
-	for _, tree := range f.Estimators {
-		tree.Fit(dpoints[:chunkSize], labels[:chunkSize])
-		rand.Shuffle(len(labels), func(i, j int) {
-			dpoints[i], dpoints[j] = dpoints[j], dpoints[i]
-			labels[i], labels[j] = labels[j], labels[i]
-		})
+// All trees know about all classes, even if their samples miss some.
+func (fc *ForestClassifier) Fit(dpoints [][]float64, labels []float64) {
+	fc.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted implements the training for the trees of the forest with
+// sample weights, which are passed on to the trees along with their examples.
+func (fc *ForestClassifier) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
+	fc.Classes = NumClasses(labels)
+	seeds, counts := fc.draws(len(fc.Estimators), len(dpoints))
+	oobDists := make([][][]float64, len(fc.Estimators))
+	oobIdx := make([][]int, len(fc.Estimators))
+	pl.Parallel(fc.NJobs, len(fc.Estimators), func(t int) {
+		tree := fc.Estimators[t]
+		tree.Classes = fc.Classes
+		tree.MaxFeatures = fc.MaxFeatures
+		tree.Seed = seeds[t]
+		tree.FitWeighted(inBag(counts[t], dpoints, labels, weights))
+		oobPoints, idx := outOfBag(counts[t], dpoints)
+		if len(idx) > 0 {
+			oobDists[t], oobIdx[t] = tree.PredictDist(oobPoints), idx
+		}
+	})
+	oob := make([][]float64, len(dpoints))
+	for t, idx := range oobIdx {
+		for j, dist := range oobDists[t] {
+			i := idx[j]
+			if oob[i] == nil {
+				oob[i] = make([]float64, fc.Classes)
+			}
+			for k, p := range dist {
+				oob[i][k] += p
+			}
+		}
+	}
+	fc.OOBDist = oob
+	fc.OOBScore = 0.0
+	var correct, total float64
+	for i, dist := range oob {
+		if dist == nil {
+			continue
+		}
+		var sum float64
+		for _, p := range dist {
+			sum += p
+		}
+		for k := range dist {
+			dist[k] /= sum
+		}
+		if Argmax(dist) == Class(labels[i], fc.Classes) {
+			correct++
+		}
+		total++
 	}
+	if total > 0.0 {
+		fc.OOBScore = correct / total
+	}
+	fc.Compile()
 }
 
-// Predict polls the trees for their predictions for each data point
-// and computes the average of their predicted labels as final prediction.
-func (f *Forest) Predict(dpoints [][]float64) []float64 {
+// Marshal and Unmarshal implement the JSONable interface (pkg: persist).
+func (fc ForestClassifier) Marshal() ([]byte, error) {
+	return json.MarshalIndent(fc, "", "    ")
+}
+
+func (fc *ForestClassifier) Unmarshal(bs []byte) error {
+	if err := json.Unmarshal(bs, fc); err != nil {
+		return err
+	}
+	fc.Compile()
+	return nil
+}
+
+// ForestRegressor implements a random forest of regression trees, whose
+// predictions are averaged. By default, the trees are trained on bootstrap
+// samples and search all dimensions for every split (see Bagging). After
+// training, OOBPrediction holds the out-of-bag predictions of the training
+// examples (NaN for examples seen by all trees) and OOBScore their
+// coefficient of determination. Like those of Forest, the trees are polled
+// in their compiled form (see Compile).
+type ForestRegressor struct {
+	Size       int              `json:"size"`
+	Estimators []*TreeRegressor `json:"trees"`
+	NJobs      int              `json:"n_jobs,omitempty"`
+	Bagging
+	OOBPrediction []float64 `json:"-"`
+	flat          []*FlatTree
+}
+
+// NewForestRegressor is the constructor function for ForestRegressor.
+// Its parameters are the number of trees and the minimum gain.
+func NewForestRegressor(nTrees int, ming float64) *ForestRegressor {
+	trees := make([]*TreeRegressor, nTrees)
+	for i, _ := range trees {
+		reg := NewTreeRegressor(ming)
+		trees[i] = &reg
+	}
+	return &ForestRegressor{Size: nTrees, Estimators: trees, Bagging: Bagging{Bootstrap: true}}
+}
+
+// Fit implements the training for the trees of the forest.
+func (fr *ForestRegressor) Fit(dpoints [][]float64, labels []float64) {
+	fr.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted implements the training for the trees of the forest with
+// sample weights, which are passed on to the trees along with their examples.
+func (fr *ForestRegressor) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
+	seeds, counts := fr.draws(len(fr.Estimators), len(dpoints))
+	oobPreds := make([][]float64, len(fr.Estimators))
+	oobIdx := make([][]int, len(fr.Estimators))
+	pl.Parallel(fr.NJobs, len(fr.Estimators), func(t int) {
+		tree := fr.Estimators[t]
+		tree.MaxFeatures = fr.MaxFeatures
+		tree.Seed = seeds[t]
+		tree.FitWeighted(inBag(counts[t], dpoints, labels, weights))
+		oobPoints, idx := outOfBag(counts[t], dpoints)
+		if len(idx) > 0 {
+			oobPreds[t], oobIdx[t] = tree.Predict(oobPoints), idx
+		}
+	})
+	sums := make([]float64, len(dpoints))
+	seen := make([]float64, len(dpoints))
+	for t, idx := range oobIdx {
+		for j, pred := range oobPreds[t] {
+			sums[idx[j]] += pred
+			seen[idx[j]]++
+		}
+	}
+	fr.OOBPrediction = make([]float64, len(dpoints))
+	fr.OOBScore = 0.0
+	var preds, oobLabels []float64
+	for i, sum := range sums {
+		if seen[i] == 0.0 {
+			fr.OOBPrediction[i] = math.NaN()
+			continue
+		}
+		fr.OOBPrediction[i] = sum / seen[i]
+		preds = append(preds, fr.OOBPrediction[i])
+		oobLabels = append(oobLabels, labels[i])
+	}
+	if len(preds) > 0 {
+		fr.OOBScore = pl.GetCoD(preds, oobLabels)
+	}
+	fr.Compile()
+}
+
+// Compile compiles the trees to flat trees (see Forest.Compile).
+func (fr *ForestRegressor) Compile() {
+	fr.flat = make([]*FlatTree, len(fr.Estimators))
+	pl.Parallel(fr.NJobs, len(fr.Estimators), func(t int) {
+		fr.flat[t] = fr.Estimators[t].Flatten()
+	})
+}
+
+// PredictTree returns the labels predicted by the t-th tree (see
+// Forest.PredictTree).
+func (fr *ForestRegressor) PredictTree(t int, dpoints [][]float64) []float64 {
+	if len(fr.flat) == len(fr.Estimators) {
+		return fr.flat[t].Predict(dpoints)
+	}
+	return fr.Estimators[t].Predict(dpoints)
+}
+
+// flatTree is a helper method that returns the compiled t-th tree,
+// compiling it if the trees have not been compiled.
+func (fr *ForestRegressor) flatTree(t int) *FlatTree {
+	if len(fr.flat) == len(fr.Estimators) {
+		return fr.flat[t]
+	}
+	return fr.Estimators[t].Flatten()
+}
+
+// Predict averages the predictions of the trees.
+func (fr *ForestRegressor) Predict(dpoints [][]float64) []float64 {
+	treePreds := make([][]float64, len(fr.Estimators))
+	pl.Parallel(fr.NJobs, len(fr.Estimators), func(t int) {
+		treePreds[t] = fr.PredictTree(t, dpoints)
+	})
 	avg := make([]float64, len(dpoints))
-	for _, tree := range f.Estimators {
-		preds := tree.Predict(dpoints)
+	for _, preds := range treePreds {
 		for i, pred := range preds {
 			avg[i] += pred
 		}
 	}
-	size := float64(f.Size)
-	for i, val := range avg {
-		avg[i] = val / size
+	size := float64(len(fr.Estimators))
+	for i := range avg {
+		avg[i] /= size
+	}
+	return avg
+}
+
+// FeatureImportances averages the normalised importances of the trees.
+func (fr *ForestRegressor) FeatureImportances() []float64 {
+	importances := make([][]float64, len(fr.Estimators))
+	for t, tree := range fr.Estimators {
+		importances[t] = tree.Importances
+	}
+	return AverageImportances(importances, nil)
+}
+
+// Score computes the coefficient of determination.
+func (fr *ForestRegressor) Score(dpoints [][]float64, labels []float64) float64 {
+	return pl.GetCoD(fr.Predict(dpoints), labels)
+}
+
+// Marshal and Unmarshal implement the JSONable interface (pkg: persist).
+func (fr ForestRegressor) Marshal() ([]byte, error) {
+	return json.MarshalIndent(fr, "", "    ")
+}
+
+func (fr *ForestRegressor) Unmarshal(bs []byte) error {
+	if err := json.Unmarshal(bs, fr); err != nil {
+		return err
+	}
+	fr.Compile()
+	return nil
+}
+
+// Predict polls the trees for their predicted classes for each data point
+// and takes the majority vote as final prediction.
+func (f *Forest) Predict(dpoints [][]float64) []float64 {
+	votes := make([][]float64, len(dpoints))
+	for i := range votes {
+		votes[i] = make([]float64, f.numClasses())
+	}
+	treePreds := make([][]float64, len(f.Estimators))
+	pl.Parallel(f.NJobs, len(f.Estimators), func(t int) {
+		treePreds[t] = f.PredictTree(t, dpoints)
+	})
+	for _, preds := range treePreds {
+		for i, pred := range preds {
+			votes[i][int(pred)]++
+		}
+	}
+	preds := make([]float64, len(dpoints))
+	for i, vote := range votes {
+		preds[i] = float64(Argmax(vote))
+	}
+	return preds
+}
+
+// PredictDist averages the class distributions as estimated by the trees.
+func (f *Forest) PredictDist(dpoints [][]float64) [][]float64 {
+	avg := make([][]float64, len(dpoints))
+	for i := range avg {
+		avg[i] = make([]float64, f.numClasses())
+	}
+	treeDists := make([][][]float64, len(f.Estimators))
+	pl.Parallel(f.NJobs, len(f.Estimators), func(t int) {
+		treeDists[t] = f.PredictTreeDist(t, dpoints)
+	})
+	for _, dists := range treeDists {
+		for i, dist := range dists {
+			for k, p := range dist {
+				avg[i][k] += p
+			}
+		}
+	}
+	size := float64(len(f.Estimators))
+	for _, dist := range avg {
+		for k := range dist {
+			dist[k] /= size
+		}
 	}
 	return avg
 }
 
+// PredictProba averages the probabilities of the positive class (class 1)
+// as estimated by the trees.
+func (f *Forest) PredictProba(dpoints [][]float64) []float64 {
+	probs := make([]float64, len(dpoints))
+	for i, dist := range f.PredictDist(dpoints) {
+		probs[i] = dist[1]
+	}
+	return probs
+}
+
+// FeatureImportances averages the normalised importances of the trees.
+func (f *Forest) FeatureImportances() []float64 {
+	importances := make([][]float64, len(f.Estimators))
+	for t, tree := range f.Estimators {
+		importances[t] = tree.Importances
+	}
+	return AverageImportances(importances, nil)
+}
+
+// numClasses returns the number of classes, which is two for forests
+// persisted before multiclass support.
+func (f *Forest) numClasses() int {
+	if f.Classes < 2 {
+		return 2
+	}
+	return f.Classes
+}
+
+// PredictClass labels the data points whose probability exceeds the threshold with 1.
+func (f *Forest) PredictClass(dpoints [][]float64, threshold float64) []float64 {
+	return pl.Classify(f.PredictProba(dpoints), threshold)
+}
+
 // Score implements the Estimator interface and additionally computes the
 // quantities of a Report struct.
 func (f *Forest) Score(dpoints [][]float64, labels []float64) float64 {
 	preds := f.Predict(dpoints)
-	f.Report = pl.GetReport(preds, labels)
+	f.Report = report(preds, labels, f.Classes)
 	return f.Report.Accuracy
 }
 
@@ -74,5 +470,9 @@ func (f Forest) Marshal() ([]byte, error) {
 }
 
 func (f *Forest) Unmarshal(bs []byte) error {
-	return json.Unmarshal(bs, f)
+	if err := json.Unmarshal(bs, f); err != nil {
+		return err
+	}
+	f.Compile()
+	return nil
 }
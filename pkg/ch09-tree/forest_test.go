@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"testing"
 
+	ds "grokml/pkg/dataset"
 	"grokml/pkg/persist"
 )
 
@@ -38,3 +39,166 @@ func TestForestClassifier(t *testing.T) {
 		t.Errorf("expected F-score %.7f, got %.7f", exp, rep.FScore(1.0))
 	}
 }
+
+func TestForestMulticlass(t *testing.T) {
+	dpoints := [][]float64{
+		{1, 1}, {2, 1}, {1, 2}, {2, 2}, {1, 3}, {2, 3},
+		{8, 1}, {9, 1}, {8, 2}, {9, 2}, {8, 3}, {9, 3},
+		{5, 8}, {6, 8}, {5, 9}, {6, 9}, {5, 7}, {6, 7},
+	}
+	labels := []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 2}
+
+	fc := NewForestClassifier(5, Gini, 0.0)
+	fc.Fit(dpoints, labels)
+	if acc := fc.Score(dpoints, labels); acc < 0.9 {
+		t.Errorf("expected accuracy of at least 0.9, got %.4f", acc)
+	}
+	for i, dist := range fc.PredictDist(dpoints) {
+		var sum float64
+		for _, p := range dist {
+			sum += p
+		}
+		if len(dist) != 3 || math.Abs(sum-1.0) > 1e-9 {
+			t.Errorf("example %d: expected distribution over 3 classes, got %v", i, dist)
+		}
+	}
+}
+
+func TestForestBootstrap(t *testing.T) {
+	dpoints := [][]float64{
+		{1, 1}, {2, 1}, {1, 2}, {2, 2}, {1, 3}, {2, 3},
+		{8, 1}, {9, 1}, {8, 2}, {9, 2}, {8, 3}, {9, 3},
+	}
+	labels := []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1}
+	first := dpoints[0]
+
+	fc := NewForestClassifier(20, Gini, 0.0)
+	fc.Seed = 7
+	fc.Fit(dpoints, labels)
+	if &dpoints[0][0] != &first[0] || labels[6] != 1.0 {
+		t.Error("expected the training data to be left untouched")
+	}
+	if fc.OOBScore < 0.9 {
+		t.Errorf("expected OOB accuracy of at least 0.9, got %.4f", fc.OOBScore)
+	}
+	for i, dist := range fc.OOBDist {
+		if dist != nil && len(dist) != 2 {
+			t.Errorf("example %d: expected OOB distribution over 2 classes, got %v", i, dist)
+		}
+	}
+	// The same seed grows the same forest.
+	fc2 := NewForestClassifier(20, Gini, 0.0)
+	fc2.Seed = 7
+	fc2.Fit(dpoints, labels)
+	if fc.OOBScore != fc2.OOBScore || fc.Estimators[19].String() != fc2.Estimators[19].String() {
+		t.Error("expected the same forest for the same seed")
+	}
+}
+
+func TestForestRegressor(t *testing.T) {
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 40; i++ {
+		x := float64(i) / 4.0
+		dpoints = append(dpoints, []float64{x, float64(i % 3)})
+		labels = append(labels, x*x)
+	}
+
+	fr := NewForestRegressor(10, 0.0)
+	fr.Fit(dpoints, labels)
+	if r2 := fr.Score(dpoints, labels); r2 < 0.95 {
+		t.Errorf("expected R2 of at least 0.95, got %.4f", r2)
+	}
+	if fr.OOBScore < 0.8 || len(fr.OOBPrediction) != len(dpoints) {
+		t.Errorf("expected OOB R2 of at least 0.8, got %.4f", fr.OOBScore)
+	}
+	persist.Dump(fr, "../../models/ch09-tree/forest_regressor.json")
+
+	fr2 := &ForestRegressor{}
+	persist.Load(fr2, "../../models/ch09-tree/forest_regressor.json")
+	got, exp := fr2.Predict(dpoints[:3]), fr.Predict(dpoints[:3])
+	for i := range exp {
+		if math.Abs(got[i]-exp[i]) > 1e-9 {
+			t.Errorf("example %d: expected %.4f, got %.4f", i, exp[i], got[i])
+		}
+	}
+}
+
+func TestForestNJobs(t *testing.T) {
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 60; i++ {
+		x, y := float64(i%10), float64(i/10)
+		dpoints = append(dpoints, []float64{x, y, float64(i % 7)})
+		if x+y > 7 {
+			labels = append(labels, 1)
+		} else {
+			labels = append(labels, 0)
+		}
+	}
+
+	var forests []*ForestClassifier
+	for _, nJobs := range []int{1, 4} {
+		fc := NewForestClassifier(8, Gini, 0.0)
+		fc.Seed, fc.NJobs = 3, nJobs
+		for _, tree := range fc.Estimators {
+			tree.NJobs = nJobs
+		}
+		fc.Fit(dpoints, labels)
+		forests = append(forests, fc)
+	}
+	// A seeded forest does not depend on the number of goroutines.
+	seq, par := forests[0], forests[1]
+	if seq.OOBScore != par.OOBScore {
+		t.Errorf("expected OOB score %.4f, got %.4f", seq.OOBScore, par.OOBScore)
+	}
+	for i, tree := range seq.Estimators {
+		if tree.String() != par.Estimators[i].String() {
+			t.Errorf("tree %d: expected\n%s\ngot\n%s", i, tree, par.Estimators[i])
+		}
+	}
+	exp, got := seq.PredictDist(dpoints), par.PredictDist(dpoints)
+	for i := range exp {
+		for k := range exp[i] {
+			if exp[i][k] != got[i][k] {
+				t.Errorf("example %d: expected %v, got %v", i, exp[i], got[i])
+				break
+			}
+		}
+	}
+}
+
+func TestForestTitanic(t *testing.T) {
+	csv := ds.NewCSVReader("../../data/titanic.csv", "Survived")
+	dset := ds.NewDataSet(csv, ds.AtoF)
+	var trainPts, testPts [][]float64
+	var trainLbs, testLbs []float64
+	for i, dpoint := range dset.DPoints() {
+		if i%5 == 0 {
+			testPts, testLbs = append(testPts, dpoint), append(testLbs, dset.Labels()[i])
+		} else {
+			trainPts, trainLbs = append(trainPts, dpoint), append(trainLbs, dset.Labels()[i])
+		}
+	}
+	// The trees of the forest split although a split draws only some of the
+	// dimensions, none of which may beat the minimum gain.
+	fc := NewForestClassifier(3, Entropy, 0.1)
+	fc.Seed = 1
+	fc.Fit(trainPts, trainLbs)
+	for i, tree := range fc.Estimators {
+		if tree.Root.Left == nil {
+			t.Errorf("tree %d: expected a split at the root", i)
+		}
+	}
+	all := NewForestClassifier(3, Entropy, 0.1)
+	all.Seed = 1
+	all.MaxFeatures = ""
+	all.Fit(trainPts, trainLbs)
+	acc, exp := fc.Score(testPts, testLbs), all.Score(testPts, testLbs)
+	if acc < exp-0.05 {
+		t.Errorf("expected accuracy of about %.3f, got %.3f", exp, acc)
+	}
+	if fc.Report.Recall == 0.0 {
+		t.Error("expected some survivors to be predicted")
+	}
+}
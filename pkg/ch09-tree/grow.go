@@ -0,0 +1,280 @@
+package ch09
+
+import (
+	"container/heap"
+	"math/rand"
+
+	pl "grokml/pkg/pipeline"
+)
+
+// Limits holds the stopping rules for growing a tree. Zero values switch
+// the corresponding rule off.
+//
+//   - MaxDepth limits the depth of the leaves (the root has depth 0).
+//   - MinSamplesSplit is the number of examples a node needs to be split.
+//   - MinSamplesLeaf is the number of examples each child of a split needs.
+//   - MaxLeafNodes limits the number of leaves. Nodes are then split
+//     best-first, ie in the order of decreasing impurity decrease.
+//   - MinImpurityDecrease is the impurity decrease a split needs, weighted
+//     with the share of examples reaching the node: N_t / N * (I(t) -
+//     N_l / N_t * I(l) - N_r / N_t * I(r)).
+type Limits struct {
+	MaxDepth            int     `json:"max_depth"`
+	MinSamplesSplit     int     `json:"min_samples_split"`
+	MinSamplesLeaf      int     `json:"min_samples_leaf"`
+	MaxLeafNodes        int     `json:"max_leaf_nodes"`
+	MinImpurityDecrease float64 `json:"min_impurity_decrease"`
+}
+
+// split holds the best split found for a node together with the examples
+// reaching the node, sorted such that the first ones go to the left child.
+type split struct {
+	node     *Node
+	examples []Example
+	info     SplitInfo
+	at       int
+	decrease float64
+	hist     histogram // histogram of the node's examples (histogram mode)
+}
+
+// splitQueue implements heap.Interface as a max-heap of splits ordered by
+// their impurity decrease.
+type splitQueue []*split
+
+func (q splitQueue) Len() int           { return len(q) }
+func (q splitQueue) Less(i, j int) bool { return q[i].decrease > q[j].decrease }
+func (q splitQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *splitQueue) Push(x any) {
+	*q = append(*q, x.(*split))
+}
+
+func (q *splitQueue) Pop() any {
+	old := *q
+	sp := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return sp
+}
+
+// grower holds the settings of a tree's growth that are threaded through
+// the split searches.
+type grower struct {
+	imp     Impurity
+	lim     Limits
+	bins    *Bins           // bin edges in histogram mode, nil for exact splits
+	classes int             // number of classes, 0 for regression
+	reg     *Regularisation // second-order splits and leaves, nil otherwise
+	total   float64         // example weight at the root
+	// column sampling per level of the tree and per split
+	rng         *rand.Rand
+	levelFrac   float64
+	levels      map[int][]int
+	maxFeatures int
+	// number of goroutines searching the dimensions
+	jobs int
+	// random thresholds instead of all split points
+	random bool
+	// mask of the categorical dimensions
+	categorical []bool
+	// impurity decreases of the splits per dimension
+	importances []float64
+}
+
+// isCategorical reports whether the d-th dimension is categorical.
+func (g *grower) isCategorical(d int) bool {
+	return d < len(g.categorical) && g.categorical[d]
+}
+
+// categoryKey returns the function by which the categories of a node are
+// sorted before they are split (see searchCategories).
+func (g *grower) categoryKey(parent Stats) func(Stats) float64 {
+	if g.reg != nil || g.classes == 0 {
+		return g.leafValue
+	}
+	major := 1
+	if g.classes > 2 {
+		major = Argmax(parent.Probs())
+	}
+	return func(st Stats) float64 {
+		probs := st.Probs()
+		if major < len(probs) {
+			return probs[major]
+		}
+		return 0.0
+	}
+}
+
+// minLeaf returns the least number of examples in a leaf.
+func (g *grower) minLeaf() int {
+	if g.lim.MinSamplesLeaf < 1 {
+		return 1
+	}
+	return g.lim.MinSamplesLeaf
+}
+
+// features returns the dimensions searched for a split at the given depth,
+// all of them or the share levelFrac drawn once per level, and how many of
+// them are searched at a time. A random forest's split searches maxFeatures
+// of them at a time, in an order drawn for every split (see sample).
+func (g *grower) features(depth, nDims int) ([]int, int) {
+	cols := g.levelFeatures(depth, nDims)
+	if g.rng == nil || g.maxFeatures <= 0 || g.maxFeatures >= len(cols) {
+		return cols, len(cols)
+	}
+	order := make([]int, len(cols))
+	for j, k := range g.rng.Perm(len(cols)) {
+		order[j] = cols[k]
+	}
+	return order, g.maxFeatures
+}
+
+// sample searches the dimensions of features with searchCols, a chunk at a
+// time, until a split has a gain above minGain, and returns the best split
+// found. As in scikit-learn, a split thus searches more dimensions than
+// drawn if the drawn ones cannot split the node.
+func (g *grower) sample(depth, nDims int, minGain float64, searchCols func(cols []int) (float64, SplitInfo)) (float64, SplitInfo) {
+	cols, size := g.features(depth, nDims)
+	var gain float64
+	var splitInfo SplitInfo
+	for at := 0; at < len(cols) && gain <= minGain; at += size {
+		end := at + size
+		if end > len(cols) {
+			end = len(cols)
+		}
+		if newGain, newInfo := searchCols(cols[at:end]); newGain > gain {
+			gain, splitInfo = newGain, newInfo
+		}
+	}
+	return gain, splitInfo
+}
+
+// search runs the split search of every given dimension, with g.jobs
+// goroutines if more than one, and returns the split with the greatest gain.
+// On equal gains, the dimension searched first wins, as it would
+// sequentially.
+func (g *grower) search(cols []int, searchDim func(d int) (float64, SplitInfo)) (float64, SplitInfo) {
+	gains := make([]float64, len(cols))
+	infos := make([]SplitInfo, len(cols))
+	pl.Parallel(g.jobs, len(cols), func(j int) {
+		gains[j], infos[j] = searchDim(cols[j])
+	})
+	var gain float64
+	var splitInfo SplitInfo
+	for j, newGain := range gains {
+		if newGain > gain {
+			gain, splitInfo = newGain, infos[j]
+		}
+	}
+	return gain, splitInfo
+}
+
+// levelFeatures returns the dimensions drawn for the given depth.
+func (g *grower) levelFeatures(depth, nDims int) []int {
+	if cols, ok := g.levels[depth]; ok {
+		return cols
+	}
+	var cols []int
+	if g.rng != nil && g.levelFrac > 0.0 && g.levelFrac < 1.0 {
+		size := int(g.levelFrac * float64(nDims))
+		if size < 1 {
+			size = 1
+		}
+		cols = g.rng.Perm(nDims)[:size]
+	} else {
+		cols = make([]int, nDims)
+		for i := range cols {
+			cols[i] = i
+		}
+	}
+	if g.levels == nil {
+		g.levels = map[int][]int{}
+	}
+	g.levels[depth] = cols
+	return cols
+}
+
+// evaluate computes the gain of a split into left and right and reports
+// whether the children satisfy the limits on their size (and, for
+// second-order splits, on their weight).
+func (g *grower) evaluate(parent, left, right Stats) (float64, bool) {
+	minLeaf := g.minLeaf()
+	if left.Count < minLeaf || right.Count < minLeaf {
+		return 0.0, false
+	}
+	if g.reg != nil {
+		return g.reg.gain(parent, left, right)
+	}
+	return computeGain(g.imp, parent, left, right), true
+}
+
+// leafValue computes the label of a node from the statistics of its examples.
+func (g *grower) leafValue(st Stats) float64 {
+	if g.reg != nil {
+		return g.reg.weight(st)
+	}
+	return st.Mean()
+}
+
+// grow trains the tree below the given root best-first. The root and every
+// child receive the weighted mean label (and class distribution) of their
+// examples and, if the limits allow, a candidate split. The candidate with
+// the greatest impurity decrease is carried out first until no candidates
+// remain or the number of leaves reaches MaxLeafNodes. Without that limit,
+// the order makes no difference.
+// In histogram mode, only the histogram of the smaller child is built from
+// its examples, the larger child's is the difference to the parent's.
+func (g *grower) grow(root *Node, examples []Example) {
+	g.total = StatsOf(examples).Weight
+	g.importances = make([]float64, len(examples[0].dpoint))
+	queue := &splitQueue{}
+	push := func(nd *Node, examples []Example, hist histogram) {
+		st := StatsOf(examples)
+		nd.Label = g.leafValue(st)
+		nd.Samples = len(examples)
+		nd.Weight = st.Weight
+		if g.imp != nil {
+			nd.Impurity = g.imp(st)
+		}
+		if g.classes > 0 {
+			st.grow(g.classes)
+			nd.Dist = st.Probs()
+		}
+		if sp, ok := nd.findSplit(examples, g, hist); ok {
+			heap.Push(queue, sp)
+		}
+	}
+	var hist histogram
+	if g.bins != nil {
+		hist = g.bins.histogram(examples)
+	}
+	push(root, examples, hist)
+	leaves := 1
+	for queue.Len() > 0 {
+		if g.lim.MaxLeafNodes > 0 && leaves >= g.lim.MaxLeafNodes {
+			break
+		}
+		sp := heap.Pop(queue).(*split)
+		nd := sp.node
+		nd.Split = sp.info
+		g.importances[sp.info.Dimension] += sp.decrease
+		// grow two leaves
+		nd.Left = NewNode(nd.Depth+1, nd.MinGain)
+		nd.Right = NewNode(nd.Depth+1, nd.MinGain)
+		leaves++
+		left, right := sp.examples[:sp.at], sp.examples[sp.at:]
+		var leftHist, rightHist histogram
+		if sp.hist != nil {
+			if len(left) <= len(right) {
+				leftHist = g.bins.histogram(left)
+				rightHist = sp.hist.minus(leftHist)
+			} else {
+				rightHist = g.bins.histogram(right)
+				leftHist = sp.hist.minus(rightHist)
+			}
+			sp.hist = nil // no longer needed
+		}
+		// delegate potential further splits
+		push(nd.Left, left, leftHist)
+		push(nd.Right, right, rightHist)
+	}
+}
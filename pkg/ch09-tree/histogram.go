@@ -0,0 +1,153 @@
+package ch09
+
+import (
+	"math"
+	"sort"
+)
+
+// MaxBins is the largest number of bins per dimension in histogram mode,
+// such that bin codes fit into a byte.
+const MaxBins = 256
+
+// Bins holds, for every dimension, the sorted edges that divide the data
+// point components into bins. A component is put into the bin given by the
+// number of edges less than or equal to it, so the edges double as split
+// thresholds: a component lies in a bin below c iff it is less than
+// Edges[d][c-1].
+type Bins struct {
+	Edges [][]float64 `json:"edges"`
+}
+
+// NewBins computes the bin edges of the data points with at most maxBins
+// bins per dimension (capped at MaxBins). If a dimension has no more
+// distinct values than bins, the edges are the midpoints between
+// consecutive distinct values, which are exactly the thresholds the exact
+// split search considers. Otherwise, the edges are placed at quantiles of
+// the values.
+func NewBins(dpoints [][]float64, maxBins int) *Bins {
+	if maxBins > MaxBins {
+		maxBins = MaxBins
+	} else if maxBins < 2 {
+		maxBins = 2
+	}
+	nDims := len(dpoints[0])
+	edges := make([][]float64, nDims)
+	for d := 0; d < nDims; d++ {
+		vals := make([]float64, 0, len(dpoints))
+		for _, dpoint := range dpoints {
+			if !math.IsNaN(dpoint[d]) { // missing components are binned last
+				vals = append(vals, dpoint[d])
+			}
+		}
+		if len(vals) == 0 {
+			continue
+		}
+		sort.Float64s(vals)
+		distinct := []float64{vals[0]}
+		for _, val := range vals[1:] {
+			if val != distinct[len(distinct)-1] {
+				distinct = append(distinct, val)
+			}
+		}
+		if len(distinct) <= maxBins {
+			for k := 1; k < len(distinct); k++ {
+				edges[d] = append(edges[d], (distinct[k-1]+distinct[k])/2.0)
+			}
+			continue
+		}
+		// quantile edges, skipping those between equal values
+		for b := 1; b < maxBins; b++ {
+			k := b * len(vals) / maxBins
+			lo, hi := vals[k-1], vals[k]
+			if lo == hi {
+				continue
+			}
+			edge := (lo + hi) / 2.0
+			if n := len(edges[d]); n == 0 || edges[d][n-1] < edge {
+				edges[d] = append(edges[d], edge)
+			}
+		}
+	}
+	return &Bins{Edges: edges}
+}
+
+// Code returns the bin of the given component of dimension d.
+func (b *Bins) Code(d int, val float64) uint8 {
+	edges := b.Edges[d]
+	return uint8(sort.Search(len(edges), func(k int) bool { return edges[k] > val }))
+}
+
+// encode assigns the bin codes to the examples.
+func (b *Bins) encode(examples []Example) {
+	for i, example := range examples {
+		codes := make([]uint8, len(example.dpoint))
+		for d, val := range example.dpoint {
+			codes[d] = b.Code(d, val)
+		}
+		examples[i].codes = codes
+	}
+}
+
+// histogram holds the label statistics of a set of examples for every
+// dimension and bin.
+type histogram [][]Stats
+
+// histogram builds the histogram of the given (encoded) examples.
+func (b *Bins) histogram(examples []Example) histogram {
+	hist := make(histogram, len(b.Edges))
+	for d, edges := range b.Edges {
+		hist[d] = make([]Stats, len(edges)+1)
+	}
+	for _, example := range examples {
+		for d, code := range example.codes {
+			hist[d][code].Add(example)
+		}
+	}
+	return hist
+}
+
+// minus removes the statistics of the other histogram, the one of a subset
+// of the examples, and returns the result. It works in place, which is fine
+// since a node's histogram is no longer needed after its split.
+func (h histogram) minus(other histogram) histogram {
+	for d, bins := range h {
+		for c := range bins {
+			bins[c].Remove(other[d][c])
+		}
+	}
+	return h
+}
+
+// bestSplit searches the split with the greatest gain among the bin edges.
+// A single pass over the bins of every dimension accumulates the statistics
+// of the left side, the right side being the rest of the parent. Missing
+// components (NaN) fall into the last bin and thus always go right.
+// Categorical dimensions are split from the node's examples instead.
+// Dimensions beyond those drawn are searched as in bestSplit.
+func (h histogram) bestSplit(examples []Example, parent Stats, depth int, minGain float64, g *grower) (float64, SplitInfo) {
+	return g.sample(depth, len(h), minGain, func(cols []int) (float64, SplitInfo) {
+		return g.search(cols, func(d int) (float64, SplitInfo) {
+			if g.isCategorical(d) {
+				return searchCategories(examples, d, parent, g)
+			}
+			var gain float64
+			var splitInfo SplitInfo
+			bins := h[d]
+			var left Stats
+			for c := 0; c < len(bins)-1; c++ {
+				if bins[c].Count == 0 { // same split as the previous edge
+					continue
+				}
+				left.Merge(bins[c])
+				right := parent.Clone()
+				right.Remove(left)
+				newGain, ok := g.evaluate(parent, left, right)
+				if ok && newGain > gain {
+					gain = newGain
+					splitInfo = SplitInfo{Dimension: d, Threshold: g.bins.Edges[d][c]}
+				}
+			}
+			return gain, splitInfo
+		})
+	})
+}
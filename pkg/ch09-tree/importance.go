@@ -0,0 +1,86 @@
+package ch09
+
+import "sort"
+
+// Importance holds the importance of a named feature.
+type Importance struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// Normalise returns the importances scaled to sum up to 1. Importances
+// that are all zero, eg of a tree without splits, stay zero.
+func Normalise(importances []float64) []float64 {
+	var sum float64
+	for _, imp := range importances {
+		sum += imp
+	}
+	norm := make([]float64, len(importances))
+	if sum <= 0.0 {
+		return norm
+	}
+	for d, imp := range importances {
+		norm[d] = imp / sum
+	}
+	return norm
+}
+
+// AverageImportances computes the weighted mean of the normalised
+// importances of several trees, weighting all trees equally if weights
+// is nil, and normalises it.
+func AverageImportances(importances [][]float64, weights []float64) []float64 {
+	var avg []float64
+	for t, imps := range importances {
+		w := 1.0
+		if weights != nil {
+			w = weights[t]
+		}
+		for len(avg) < len(imps) {
+			avg = append(avg, 0.0)
+		}
+		for d, imp := range Normalise(imps) {
+			avg[d] += w * imp
+		}
+	}
+	return Normalise(avg)
+}
+
+// NameImportances pairs the importances with the feature names of a header
+// and sorts them by decreasing importance. If the header has one name more
+// than there are importances, as the header of a DataSet, the first one
+// names the label and is skipped.
+func NameImportances(importances []float64, header []string) []Importance {
+	if len(header) == len(importances)+1 {
+		header = header[1:]
+	}
+	named := make([]Importance, len(importances))
+	for d, imp := range importances {
+		named[d] = Importance{Value: imp}
+		if d < len(header) {
+			named[d].Name = header[d]
+		}
+	}
+	sort.SliceStable(named, func(i, j int) bool {
+		return named[i].Value > named[j].Value
+	})
+	return named
+}
+
+// decreases is a helper function that adds up the impurity decreases of the
+// splits below the node per dimension, weighted with their share of the
+// total sample weight.
+func decreases(nd *Node, total float64, importances []float64) {
+	if nd.Left == nil {
+		return
+	}
+	importances[nd.Split.Dimension] += (nd.Weight*nd.Impurity - nd.Left.Weight*nd.Left.Impurity -
+		nd.Right.Weight*nd.Right.Impurity) / total
+	decreases(nd.Left, total, importances)
+	decreases(nd.Right, total, importances)
+}
+
+// FeatureImportances returns the normalised impurity-based importances of
+// the dimensions, ie the mean decrease in impurity that their splits achieve.
+func (dt *Tree) FeatureImportances() []float64 {
+	return Normalise(dt.Importances)
+}
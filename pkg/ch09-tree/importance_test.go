@@ -0,0 +1,47 @@
+package ch09
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFeatureImportances(t *testing.T) {
+	// The label depends on the first component only.
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 30; i++ {
+		dpoints = append(dpoints, []float64{float64(i), float64(i % 7), 1})
+		if i >= 15 {
+			labels = append(labels, 1)
+		} else {
+			labels = append(labels, 0)
+		}
+	}
+
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Fit(dpoints, labels)
+	imps := dt.FeatureImportances()
+	if len(imps) != 3 || imps[0] != 1.0 || imps[1] != 0.0 || imps[2] != 0.0 {
+		t.Errorf("expected importances [1 0 0], got %v", imps)
+	}
+	// The decrease of the root split is the Gini impurity 0.5 of the labels.
+	if math.Abs(dt.Importances[0]-0.5) > 1e-9 {
+		t.Errorf("expected decrease 0.5, got %.4f", dt.Importances[0])
+	}
+
+	fc := NewForestClassifier(10, Gini, 0.0)
+	fc.Fit(dpoints, labels)
+	imps = fc.FeatureImportances()
+	var sum float64
+	for _, imp := range imps {
+		sum += imp
+	}
+	if math.Abs(sum-1.0) > 1e-9 || imps[0] <= imps[1] || imps[2] != 0.0 {
+		t.Errorf("expected the first component to matter most, got %v", imps)
+	}
+
+	named := NameImportances([]float64{0.2, 0.8}, []string{"label", "x", "y"})
+	if named[0].Name != "y" || named[0].Value != 0.8 || named[1].Name != "x" {
+		t.Errorf("expected y before x, got %+v", named)
+	}
+}
@@ -6,58 +6,176 @@ import (
 
 const threshold = 0.5
 
-// prob is a helper function to compute the relative frequency of examples
-// whose label surpasses the threshold.
-func prob(examples []Example) float64 {
-	var sum float64
+// Stats holds the label statistics of a set of examples that impurities are
+// computed from: the total weight of the examples, the weight of those whose
+// label surpasses the threshold, and the weighted sum and sum of squares of
+// the labels, as well as their number. For classification, Dist holds the
+// weight of the examples per class. Stats can be updated example by example
+// so that a sorted pass over the examples yields the statistics of every
+// candidate split. As Dist is a slice, copies must be made with Clone.
+// For second-order boosting, Grad and Hess hold the weighted sums of the
+// gradients and second derivatives of the loss.
+type Stats struct {
+	Weight float64
+	Pos    float64
+	Sum    float64
+	SumSq  float64
+	Count  int
+	Dist   []float64
+	Grad   float64
+	Hess   float64
+}
+
+// StatsOf computes the statistics of the given examples.
+func StatsOf(examples []Example) Stats {
+	var st Stats
 	for _, example := range examples {
-		if example.label > threshold {
-			sum++
-		}
+		st.Add(example)
 	}
-	return sum / float64(len(examples))
+	return st
 }
 
-// Impurity is a function type that computes the impurity
-// of the given set of examples.
-type Impurity func(examples []Example) float64
+// Add includes the example in the statistics.
+func (st *Stats) Add(example Example) {
+	w, y := example.weight, example.label
+	st.Weight += w
+	if y > threshold {
+		st.Pos += w
+	}
+	st.Sum += w * y
+	st.SumSq += w * y * y
+	st.Count++
+	st.Grad += w * example.grad
+	st.Hess += w * example.hess
+	if example.class >= 0 {
+		st.grow(example.class + 1)
+		st.Dist[example.class] += w
+	}
+}
 
-// computeGain calculates the loss of impurity of a given split where
-// the split is characterised by its slice index.
-func computeGain(eval Impurity, examples []Example, split int) float64 {
-	oldVal := eval(examples)
-	newVal := 0.5 * (eval(examples[:split]) + eval(examples[split:]))
-	return oldVal - newVal
+// Sub removes the example from the statistics.
+func (st *Stats) Sub(example Example) {
+	w, y := example.weight, example.label
+	st.Weight -= w
+	if y > threshold {
+		st.Pos -= w
+	}
+	st.Sum -= w * y
+	st.SumSq -= w * y * y
+	st.Count--
+	st.Grad -= w * example.grad
+	st.Hess -= w * example.hess
+	if example.class >= 0 {
+		st.grow(example.class + 1)
+		st.Dist[example.class] -= w
+	}
 }
 
-// Entropy implements the impurity function type suitable for classifications.
-func Entropy(examples []Example) float64 {
-	p := prob(examples)
-	if math.Abs(p-1.0) < 1e-4 || p < 1e-4 {
-		return 0.0
+// Merge includes the statistics of another set of examples.
+func (st *Stats) Merge(other Stats) {
+	st.Weight += other.Weight
+	st.Pos += other.Pos
+	st.Sum += other.Sum
+	st.SumSq += other.SumSq
+	st.Count += other.Count
+	st.Grad += other.Grad
+	st.Hess += other.Hess
+	st.grow(len(other.Dist))
+	for k, w := range other.Dist {
+		st.Dist[k] += w
 	}
-	return -p*math.Log(p) - (1.0-p)*math.Log(1.0-p)
 }
 
-// Gini implements the impurity function type. It is suitable for classifications.
-func Gini(examples []Example) float64 {
-	p := prob(examples)
-	return 2.0 * p * (1.0 - p)
+// Remove removes the statistics of a subset of the examples.
+func (st *Stats) Remove(other Stats) {
+	st.Weight -= other.Weight
+	st.Pos -= other.Pos
+	st.Sum -= other.Sum
+	st.SumSq -= other.SumSq
+	st.Count -= other.Count
+	st.Grad -= other.Grad
+	st.Hess -= other.Hess
+	st.grow(len(other.Dist))
+	for k, w := range other.Dist {
+		st.Dist[k] -= w
+	}
 }
 
-// MSE implements the impurity function type. It is suitable for regression, aka
-// mean-squared error.
-func MSE(examples []Example) float64 {
-	var mean float64 // compute the mean
-	size := float64(len(examples))
-	for _, example := range examples {
-		mean += example.label
+// Clone returns a copy of the statistics that does not share Dist.
+func (st Stats) Clone() Stats {
+	if st.Dist != nil {
+		st.Dist = append([]float64(nil), st.Dist...)
 	}
-	mean /= size
-	var val float64 // compute the standard deviation
-	for _, example := range examples {
-		val += (example.label - mean) * (example.label - mean)
+	return st
+}
+
+// grow is a helper method that makes room for the given number of classes.
+func (st *Stats) grow(nClasses int) {
+	for len(st.Dist) < nClasses {
+		st.Dist = append(st.Dist, 0.0)
+	}
+}
+
+// Mean returns the weighted mean label.
+func (st Stats) Mean() float64 {
+	return st.Sum / st.Weight
+}
+
+// Probs returns the relative frequencies (weights) of the classes. Without
+// class weights, the labels are turned binary by the threshold.
+func (st Stats) Probs() []float64 {
+	if st.Dist == nil {
+		p := st.Pos / st.Weight
+		return []float64{1.0 - p, p}
+	}
+	probs := make([]float64, len(st.Dist))
+	for k, w := range st.Dist {
+		probs[k] = w / st.Weight
+	}
+	return probs
+}
+
+// Impurity is a function type that computes the impurity of a set of
+// examples from their statistics.
+type Impurity func(st Stats) float64
+
+// computeGain calculates the loss of impurity of a given split into the
+// examples described by left and right. The impurities of the children are
+// weighted with their share of the parent's example weight.
+func computeGain(eval Impurity, parent, left, right Stats) float64 {
+	newVal := left.Weight/parent.Weight*eval(left) + right.Weight/parent.Weight*eval(right)
+	return eval(parent) - newVal
+}
+
+// Entropy implements the impurity function type suitable for classifications
+// with any number of classes.
+func Entropy(st Stats) float64 {
+	var val float64
+	for _, p := range st.Probs() {
+		if p > 1e-12 { // rounding
+			val -= p * math.Log(p)
+		}
+	}
+	return val
+}
+
+// Gini implements the impurity function type. It is suitable for classifications
+// with any number of classes.
+func Gini(st Stats) float64 {
+	val := 1.0
+	for _, p := range st.Probs() {
+		val -= p * p
+	}
+	return val
+}
+
+// MSE implements the impurity function type. It is suitable for regression, aka
+// mean-squared error, ie the variance of the labels.
+func MSE(st Stats) float64 {
+	mean := st.Mean()
+	val := st.SumSq/st.Weight - mean*mean
+	if val < 0.0 { // rounding
+		return 0.0
 	}
-	val /= size
 	return val
 }
@@ -0,0 +1,85 @@
+package ch09
+
+import "math/rand"
+
+// Regularisation holds the parameters of second-order (Newton) trees as
+// grown by XGBoost-style boosting. Instead of labels, these trees see the
+// gradients g and second derivatives h of the loss at the current
+// predictions. With G and H their sums over the examples of a node, the
+// node's label is the leaf weight -T(G)/(H + Lambda), where T shrinks G
+// towards zero by Alpha (L1), and a split gains
+//
+//	1/2 [T(G_l)²/(H_l + Lambda) + T(G_r)²/(H_r + Lambda) - T(G)²/(H + Lambda)] - Gamma.
+//
+// Splits must gain more than zero and leave both children a sum of second
+// derivatives of at least MinChildWeight.
+type Regularisation struct {
+	Lambda         float64 `json:"lambda"`
+	Alpha          float64 `json:"alpha"`
+	Gamma          float64 `json:"gamma"`
+	MinChildWeight float64 `json:"min_child_weight"`
+}
+
+// shrink soft-thresholds the gradient sum by Alpha.
+func (reg *Regularisation) shrink(grad float64) float64 {
+	if grad > reg.Alpha {
+		return grad - reg.Alpha
+	} else if grad < -reg.Alpha {
+		return grad + reg.Alpha
+	}
+	return 0.0
+}
+
+// score computes the loss reduction achieved by a node's optimal leaf weight.
+func (reg *Regularisation) score(st Stats) float64 {
+	den := st.Hess + reg.Lambda
+	if den <= 0.0 {
+		return 0.0
+	}
+	grad := reg.shrink(st.Grad)
+	return grad * grad / den
+}
+
+// gain computes the gain of a split and reports whether both children are
+// heavy enough.
+func (reg *Regularisation) gain(parent, left, right Stats) (float64, bool) {
+	if left.Hess < reg.MinChildWeight || right.Hess < reg.MinChildWeight {
+		return 0.0, false
+	}
+	return 0.5*(reg.score(left)+reg.score(right)-reg.score(parent)) - reg.Gamma, true
+}
+
+// weight computes the optimal leaf weight of a node.
+func (reg *Regularisation) weight(st Stats) float64 {
+	den := st.Hess + reg.Lambda
+	if den <= 0.0 {
+		return 0.0
+	}
+	return -reg.shrink(st.Grad) / den
+}
+
+// FitNewton grows a second-order tree from the gradients and second
+// derivatives of a loss at the data points, weighted with the sample
+// weights. The leaf labels are the regularised Newton steps that minimise
+// the second-order approximation of the loss, so they are to be added to
+// the current predictions. If ColSampleLevel is between 0 and 1, every
+// level of the tree searches splits in that share of the dimensions,
+// drawn from rng. Data point components may be missing (NaN); splits then
+// learn the default direction that suits them best.
+func (dt *Tree) FitNewton(dpoints [][]float64, grads, hessians, weights []float64, reg Regularisation, rng *rand.Rand) {
+	examples := MakeExamples(dpoints, grads)
+	for i := range examples {
+		examples[i].weight = weights[i]
+		examples[i].grad = grads[i]
+		examples[i].hess = hessians[i]
+	}
+	dt.Root = NewNode(0, dt.MinGain)
+	g := &grower{lim: dt.Limits, reg: &reg, rng: rng, levelFrac: dt.ColSampleLevel, jobs: dt.NJobs}
+	g.categorical = dt.Categorical
+	if dt.MaxBins > 0 {
+		g.bins = NewBins(dpoints, dt.MaxBins)
+		g.bins.encode(examples)
+	}
+	g.grow(dt.Root, examples)
+	dt.Importances = g.importances
+}
@@ -0,0 +1,63 @@
+package ch09
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitNewton(t *testing.T) {
+	dpoints := [][]float64{{1}, {2}, {3}, {4}, {5}, {6}}
+	labels := []float64{1, 1, 1, 5, 5, 5}
+	// For the squared loss at zero, g = -y and h = 1.
+	grads := make([]float64, len(labels))
+	for i, label := range labels {
+		grads[i] = -label
+	}
+	hess, weights := []float64{1, 1, 1, 1, 1, 1}, []float64{1, 1, 1, 1, 1, 1}
+
+	dt := NewTreeRegressor(0.0)
+	dt.FitNewton(dpoints, grads, hess, weights, Regularisation{}, nil)
+	if got := dt.Predict([][]float64{{1}, {6}}); got[0] != 1.0 || got[1] != 5.0 {
+		t.Errorf("expected leaf weights [1 5], got %v", got)
+	}
+	// L2 regularisation shrinks the leaf weights: 15 / (3 + 1).
+	dt.FitNewton(dpoints, grads, hess, weights, Regularisation{Lambda: 1.0}, nil)
+	if got := dt.Predict([][]float64{{6}})[0]; math.Abs(got-3.75) > 1e-9 {
+		t.Errorf("expected leaf weight 3.75, got %.4f", got)
+	}
+	// L1 regularisation shrinks the gradient sums: (15 - 3) / 3.
+	dt.FitNewton(dpoints, grads, hess, weights, Regularisation{Alpha: 3.0}, nil)
+	if got := dt.Predict([][]float64{{6}})[0]; math.Abs(got-4.0) > 1e-9 {
+		t.Errorf("expected leaf weight 4, got %.4f", got)
+	}
+	// The split gains 1/2 (9/3 + 225/3 - 324/6) = 12.
+	for _, reg := range []Regularisation{{Gamma: 12.5}, {MinChildWeight: 3.5}} {
+		dt.FitNewton(dpoints, grads, hess, weights, reg, nil)
+		if dt.Root.Left != nil {
+			t.Errorf("expected no split with %+v", reg)
+		}
+	}
+}
+
+func TestMissingValues(t *testing.T) {
+	nan := math.NaN()
+	dpoints := [][]float64{{1}, {2}, {nan}, {4}, {5}, {nan}}
+	// The examples missing the component belong with the small values.
+	labels := []float64{0, 0, 0, 1, 1, 0}
+
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Fit(dpoints, labels)
+	if split := dt.Root.Split; !split.MissingLeft {
+		t.Errorf("expected missing values to go left, got %+v", split)
+	}
+	got := dt.Predict([][]float64{{nan}, {1.5}, {4.5}})
+	exp := []float64{0, 0, 1}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("example %d: expected class %v, got %v", i, exp[i], got[i])
+		}
+	}
+	if acc := dt.Score(dpoints, labels); acc != 1.0 {
+		t.Errorf("expected accuracy 1, got %.4f", acc)
+	}
+}
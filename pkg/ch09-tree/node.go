@@ -2,43 +2,103 @@ package ch09
 
 import (
 	"fmt"
+	"math"
 	"sort"
 )
 
 // Examples implements a container class for labelled training examples.
-// This is suitable for both decision and regression trees.
+// This is suitable for both decision and regression trees. The weight
+// scales the example's contribution to impurities and leaf labels.
 type Example struct {
 	dpoint []float64 // data point
 	label  float64
+	weight float64
+	class  int     // index of the class (classification), -1 otherwise
+	codes  []uint8 // bin codes of the data point components (histogram mode)
+	grad   float64 // gradient of the loss (second-order boosting)
+	hess   float64 // second derivative of the loss (second-order boosting)
 }
 
 // MakeExamples is a factory function to package up data points and their
-// labels into Example objects.
+// labels into Example objects of unit weight.
 func MakeExamples(dpoints [][]float64, labels []float64) []Example {
 	examples := make([]Example, len(dpoints))
 	for i, dpoint := range dpoints {
-		examples[i] = Example{dpoint, labels[i]}
+		examples[i] = Example{dpoint: dpoint, label: labels[i], weight: 1.0, class: -1}
 	}
 	return examples
 }
 
-// SplitInfo holds necessary information about a split.
+// SplitInfo holds necessary information about a split. Data points
+// missing the component (NaN) take the default direction given by
+// MissingLeft. Splits of categorical components send the data points whose
+// component is one of Categories to the left, the others to the right.
 type SplitInfo struct {
-	Dimension int     `json:"dimension"`
-	Threshold float64 `json:"threshold"`
+	Dimension   int       `json:"dimension"`
+	Threshold   float64   `json:"threshold"`
+	Categories  []float64 `json:"categories,omitempty"`
+	MissingLeft bool      `json:"missing_left,omitempty"`
+}
+
+// goesLeft decides whether a data point is passed to the left child.
+func (si SplitInfo) goesLeft(dpoint []float64) bool {
+	val := dpoint[si.Dimension]
+	if math.IsNaN(val) {
+		return si.MissingLeft
+	}
+	if si.Categories != nil {
+		for _, cat := range si.Categories {
+			if val == cat {
+				return true
+			}
+		}
+		return false
+	}
+	return val < si.Threshold
+}
+
+// partition reorders the examples such that those passed to the left child
+// come first and returns their number.
+func partition(examples []Example, si SplitInfo) int {
+	var at int
+	for j, example := range examples {
+		if si.goesLeft(example.dpoint) {
+			examples[at], examples[j] = examples[j], examples[at]
+			at++
+		}
+	}
+	return at
 }
 
 // Node implements the nodes of a decision or regression tree.
-// It knows about its depth as counted from the root and the
-// minimum gain in purity needed to be obtained by a potential
-// split. If it has children, it also holds split information.
+// It knows about its depth as counted from the root, the number of
+// training examples that reached it and the minimum gain in purity
+// needed to be obtained by a potential split. If it has children, it
+// also holds split information. Its label is the mean label of its
+// examples, which is used for prediction once it is a leaf. In
+// classification trees, it also holds the class distribution of its examples.
+// Impurity and Weight are the impurity and the total sample weight of its
+// examples, from which pruning computes the cost of the node.
 type Node struct {
-	Label   float64   `json:"label"`
-	Split   SplitInfo `json:"split_info"`
-	Depth   int       `json:"depth"`
-	MinGain float64   `json:"min_gain"`
-	Left    *Node     `json:"left"`
-	Right   *Node     `json:"right"`
+	Label    float64   `json:"label"`
+	Dist     []float64 `json:"dist,omitempty"`
+	Split    SplitInfo `json:"split_info"`
+	Depth    int       `json:"depth"`
+	Samples  int       `json:"samples"`
+	Impurity float64   `json:"impurity,omitempty"`
+	Weight   float64   `json:"weight,omitempty"`
+	MinGain  float64   `json:"min_gain"`
+	Left     *Node     `json:"left"`
+	Right    *Node     `json:"right"`
+}
+
+// dist returns the class distribution of the node. Nodes of binary trees
+// trained without class distributions derive it from the label.
+func (n *Node) dist() []float64 {
+	if n.Dist == nil {
+		return []float64{1.0 - n.Label, n.Label}
+	}
+	return n.Dist
 }
 
 // NewNode is a factory function for Node structs. The depth
@@ -66,45 +126,269 @@ func (n *Node) String() string {
 // Fit performs the decision-tree training. Every node minds its own splits.
 // It will end up as a leaf if the gain is not big enough.
 func (n *Node) Fit(examples []Example, imp Impurity) {
+	g := &grower{imp: imp}
+	g.grow(n, examples)
+}
+
+// findSplit searches the split with the greatest gain. It reports false
+// if the node must stay a leaf, either because the limits forbid a split
+// or because no split is worth it. In histogram mode, the split is found
+// from the node's histogram, otherwise from the examples themselves.
+// If a split is found, the examples are partitioned accordingly.
+func (n *Node) findSplit(examples []Example, g *grower, hist histogram) (*split, bool) {
+	size := len(examples)
+	if g.lim.MaxDepth > 0 && n.Depth >= g.lim.MaxDepth {
+		return nil, false
+	}
+	if size < g.lim.MinSamplesSplit || size < 2*g.minLeaf() {
+		return nil, false
+	}
+	parent := StatsOf(examples)
 	var gain float64
 	var splitInfo SplitInfo
-	var splitAt int
-	nDims := len(examples[0].dpoint)
-	size := len(examples)
-	for i := 0; i < nDims; i++ {
-		// Sort examples by their i-th data point component.
-		sort.Slice(examples, func(k, j int) bool {
-			return examples[k].dpoint[i] < examples[j].dpoint[i]
+	if hist != nil {
+		gain, splitInfo = hist.bestSplit(examples, parent, n.Depth, n.MinGain, g)
+	} else {
+		gain, splitInfo = bestSplit(examples, parent, n.Depth, n.MinGain, g)
+	}
+	if gain <= n.MinGain { // it must be worth it
+		return nil, false
+	}
+	// impurity decrease weighted with the share of example weight
+	decrease := parent.Weight / g.total * gain
+	if decrease < g.lim.MinImpurityDecrease {
+		return nil, false
+	}
+	splitAt := partition(examples, splitInfo)
+	sp := &split{node: n, examples: examples, info: splitInfo, at: splitAt, decrease: decrease, hist: hist}
+	return sp, true
+}
+
+// bestSplit is a helper function that searches the split with the greatest
+// gain among all split points between distinct data point components.
+// The dimensions are searched independently (see grower.search), and
+// beyond those drawn until a split beats minGain (see grower.sample).
+func bestSplit(examples []Example, parent Stats, depth int, minGain float64, g *grower) (float64, SplitInfo) {
+	return g.sample(depth, len(examples[0].dpoint), minGain, func(cols []int) (float64, SplitInfo) {
+		if g.random {
+			thresholds := g.thresholds(examples, cols)
+			return g.search(cols, func(i int) (float64, SplitInfo) {
+				if g.isCategorical(i) {
+					return searchCategories(examples, i, parent, g)
+				}
+				return tryThreshold(examples, i, thresholds[i], parent, g)
+			})
+		}
+		return g.search(cols, func(i int) (float64, SplitInfo) {
+			if g.isCategorical(i) {
+				return searchCategories(examples, i, parent, g)
+			}
+			return searchDimension(examples, i, parent, g)
 		})
-		// Find split with greatest gain.
-		for j := 1; j < size; j++ {
-			newGain := computeGain(imp, examples, j)
-			if newGain > gain {
+	})
+}
+
+// searchDimension is a helper function that searches the split with the
+// greatest gain along the i-th dimension. The examples are copied and sorted
+// once and the statistics of both sides are updated while the split point
+// moves through them. Examples missing the component are tried on either
+// side and the better one becomes the default direction. Without missing
+// components, the default direction is the heavier child.
+func searchDimension(examples []Example, i int, parent Stats, g *grower) (float64, SplitInfo) {
+	var gain float64
+	var splitInfo SplitInfo
+	// Move the examples missing the i-th component to the end.
+	sorted := make([]Example, len(examples))
+	copy(sorted, examples)
+	size := len(sorted)
+	for j := 0; j < size; {
+		if math.IsNaN(sorted[j].dpoint[i]) {
+			size--
+			sorted[j], sorted[size] = sorted[size], sorted[j]
+		} else {
+			j++
+		}
+	}
+	present := sorted[:size]
+	missing := StatsOf(sorted[size:])
+	// Sort examples by their i-th data point component.
+	sort.Slice(present, func(k, j int) bool {
+		return present[k].dpoint[i] < present[j].dpoint[i]
+	})
+	// Find split with greatest gain.
+	var left Stats
+	right := parent.Clone()
+	right.Remove(missing)
+	for j := 1; j < size; j++ {
+		left.Add(present[j-1])
+		right.Sub(present[j-1])
+		lo, hi := present[j-1].dpoint[i], present[j].dpoint[i]
+		if lo == hi { // equal values cannot be separated
+			continue
+		}
+		threshold := (lo + hi) / 2.0
+		if missing.Count == 0 {
+			if newGain, ok := g.evaluate(parent, left, right); ok && newGain > gain {
 				gain = newGain
-				thresh := (examples[j-1].dpoint[i] + examples[j].dpoint[i]) / 2.0
-				splitAt = j
-				splitInfo = SplitInfo{Dimension: i, Threshold: thresh}
+				splitInfo = SplitInfo{Dimension: i, Threshold: threshold, MissingLeft: left.Weight > right.Weight}
 			}
+			continue
+		}
+		withMissing := right.Clone()
+		withMissing.Merge(missing)
+		if newGain, ok := g.evaluate(parent, left, withMissing); ok && newGain > gain {
+			gain = newGain
+			splitInfo = SplitInfo{Dimension: i, Threshold: threshold}
+		}
+		withMissing = left.Clone()
+		withMissing.Merge(missing)
+		if newGain, ok := g.evaluate(parent, withMissing, right); ok && newGain > gain {
+			gain = newGain
+			splitInfo = SplitInfo{Dimension: i, Threshold: threshold, MissingLeft: true}
 		}
 	}
-	if gain > n.MinGain { // it must be worth it
-		n.Split = splitInfo
-		d := splitInfo.Dimension
-		sort.Slice(examples, func(k, j int) bool {
-			return examples[k].dpoint[d] < examples[j].dpoint[d]
-		})
-		// grow two leaves
-		n.Left = NewNode(n.Depth+1, n.MinGain)
-		n.Right = NewNode(n.Depth+1, n.MinGain)
-		// delegate potential further splits
-		n.Left.Fit(examples[:splitAt], imp)
-		n.Right.Fit(examples[splitAt:], imp)
-	} else {
-		var avg float64
-		for _, example := range examples {
-			avg += example.label
+	return gain, splitInfo
+}
+
+// searchCategories is a helper function that searches the split of the
+// categories of the i-th component with the greatest gain. The categories
+// are sorted by the mean label of their examples (the leaf value of
+// second-order trees, the share of the node's majority class for more than
+// two classes) and split like numeric components in this order, which finds
+// the best subset for regression and binary classification without trying
+// all of them. Examples missing the component are tried on either side.
+func searchCategories(examples []Example, i int, parent Stats, g *grower) (float64, SplitInfo) {
+	var cats []float64
+	groups := map[float64]*Stats{}
+	var missing Stats
+	for _, ex := range examples {
+		val := ex.dpoint[i]
+		if math.IsNaN(val) {
+			missing.Add(ex)
+			continue
+		}
+		st, ok := groups[val]
+		if !ok {
+			st = &Stats{}
+			groups[val] = st
+			cats = append(cats, val)
+		}
+		st.Add(ex)
+	}
+	key := g.categoryKey(parent)
+	keys := make(map[float64]float64, len(cats))
+	for _, cat := range cats {
+		keys[cat] = key(*groups[cat])
+	}
+	sort.Slice(cats, func(k, j int) bool {
+		if keys[cats[k]] != keys[cats[j]] {
+			return keys[cats[k]] < keys[cats[j]]
+		}
+		return cats[k] < cats[j]
+	})
+	var gain float64
+	var best int
+	var missingLeft bool
+	var left Stats
+	right := parent.Clone()
+	right.Remove(missing)
+	for j := 1; j < len(cats); j++ {
+		left.Merge(*groups[cats[j-1]])
+		right.Remove(*groups[cats[j-1]])
+		if missing.Count == 0 {
+			if newGain, ok := g.evaluate(parent, left, right); ok && newGain > gain {
+				gain, best, missingLeft = newGain, j, left.Weight > right.Weight
+			}
+			continue
+		}
+		withMissing := right.Clone()
+		withMissing.Merge(missing)
+		if newGain, ok := g.evaluate(parent, left, withMissing); ok && newGain > gain {
+			gain, best, missingLeft = newGain, j, false
+		}
+		withMissing = left.Clone()
+		withMissing.Merge(missing)
+		if newGain, ok := g.evaluate(parent, withMissing, right); ok && newGain > gain {
+			gain, best, missingLeft = newGain, j, true
+		}
+	}
+	if best == 0 {
+		return 0.0, SplitInfo{}
+	}
+	subset := append([]float64(nil), cats[:best]...)
+	sort.Float64s(subset)
+	return gain, SplitInfo{Dimension: i, Categories: subset, MissingLeft: missingLeft}
+}
+
+// thresholds is a helper method that draws a threshold for each of the
+// given dimensions, uniformly between the least and greatest component of
+// the examples. Dimensions without distinct components get NaN. The
+// thresholds are drawn before the dimensions are searched, which keeps
+// them independent of the number of goroutines.
+func (g *grower) thresholds(examples []Example, cols []int) map[int]float64 {
+	thresholds := make(map[int]float64, len(cols))
+	for _, i := range cols {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, ex := range examples {
+			val := ex.dpoint[i]
+			if val < lo {
+				lo = val
+			}
+			if val > hi {
+				hi = val
+			}
+		}
+		if lo >= hi {
+			thresholds[i] = math.NaN()
+			continue
 		}
-		avg /= float64(size)
-		n.Label = avg
+		threshold := lo + g.rng.Float64()*(hi-lo)
+		if threshold == lo { // leave at least one example on the left
+			threshold = (lo + hi) / 2.0
+		}
+		thresholds[i] = threshold
+	}
+	return thresholds
+}
+
+// tryThreshold is a helper function that computes the gain of splitting
+// the examples at the threshold along the i-th dimension. Examples missing
+// the component are tried on either side, as in searchDimension.
+func tryThreshold(examples []Example, i int, threshold float64, parent Stats, g *grower) (float64, SplitInfo) {
+	if math.IsNaN(threshold) {
+		return 0.0, SplitInfo{}
+	}
+	var left, missing Stats
+	for _, ex := range examples {
+		if math.IsNaN(ex.dpoint[i]) {
+			missing.Add(ex)
+		} else if ex.dpoint[i] < threshold {
+			left.Add(ex)
+		}
+	}
+	right := parent.Clone()
+	right.Remove(left)
+	if missing.Count == 0 {
+		gain, ok := g.evaluate(parent, left, right)
+		if !ok {
+			return 0.0, SplitInfo{}
+		}
+		return gain, SplitInfo{Dimension: i, Threshold: threshold, MissingLeft: left.Weight > right.Weight}
+	}
+	right.Remove(missing)
+	var gain float64
+	var splitInfo SplitInfo
+	withMissing := right.Clone()
+	withMissing.Merge(missing)
+	if newGain, ok := g.evaluate(parent, left, withMissing); ok && newGain > gain {
+		gain = newGain
+		splitInfo = SplitInfo{Dimension: i, Threshold: threshold}
+	}
+	withMissing = left.Clone()
+	withMissing.Merge(missing)
+	if newGain, ok := g.evaluate(parent, withMissing, right); ok && newGain > gain {
+		gain = newGain
+		splitInfo = SplitInfo{Dimension: i, Threshold: threshold, MissingLeft: true}
 	}
+	return gain, splitInfo
 }
@@ -1,15 +1,15 @@
 package ch09
 
 import (
+	"math"
 	"testing"
 )
 
 func TestNode(t *testing.T) {
-	examples := []Example{
-		{[]float64{18, 12000, 1}, 0.91},
-		{[]float64{32, 30000, 0}, 0.23},
-		{[]float64{21, 32000, 1}, 0.12},
-	}
+	examples := MakeExamples(
+		[][]float64{{18, 12000, 1}, {32, 30000, 0}, {21, 32000, 1}},
+		[]float64{0.91, 0.23, 0.12},
+	)
 	nd := NewNode(0, 0.1)
 	nd.Fit(examples, Gini)
 	exp := 0.910
@@ -21,3 +21,45 @@ func TestNode(t *testing.T) {
 		t.Errorf("Expected label %.3f, got %.3f", exp, nd.Right.Label)
 	}
 }
+
+func TestComputeGain(t *testing.T) {
+	examples := MakeExamples([][]float64{{1}, {2}, {3}, {4}}, []float64{0, 0, 1, 1})
+	parent := StatsOf(examples)
+	// A pure balanced split removes all impurity.
+	got := computeGain(Gini, parent, StatsOf(examples[:2]), StatsOf(examples[2:]))
+	if exp := 0.5; got != exp {
+		t.Errorf("expected gain %.4f, got %.4f", exp, got)
+	}
+	// Peeling off one example weights the impure rest with 3/4.
+	got = computeGain(Gini, parent, StatsOf(examples[:1]), StatsOf(examples[1:]))
+	if exp := 0.5 - 0.75*4.0/9.0; math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected gain %.4f, got %.4f", exp, got)
+	}
+	// Sample weights count like repeated examples.
+	examples[0].weight = 3.0
+	left, right := StatsOf(examples[:1]), StatsOf(examples[1:])
+	got = computeGain(Gini, StatsOf(examples), left, right)
+	if exp := 4.0/9.0 - 0.5*4.0/9.0; math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected weighted gain %.4f, got %.4f", exp, got)
+	}
+}
+
+func TestMulticlassImpurity(t *testing.T) {
+	examples := MakeExamples([][]float64{{1}, {2}, {3}}, []float64{0, 1, 2})
+	for i := range examples {
+		examples[i].class = int(examples[i].label)
+	}
+	st := StatsOf(examples)
+	if got, exp := Gini(st), 2.0/3.0; math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected Gini impurity %.4f, got %.4f", exp, got)
+	}
+	if got, exp := Entropy(st), math.Log(3.0); math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected entropy %.4f, got %.4f", exp, got)
+	}
+	// Removing examples leaves the clone untouched.
+	cl := st.Clone()
+	st.Sub(examples[0])
+	if cl.Dist[0] != 1.0 {
+		t.Errorf("expected cloned class weight 1, got %v", cl.Dist[0])
+	}
+}
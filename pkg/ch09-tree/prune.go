@@ -0,0 +1,268 @@
+package ch09
+
+import "math"
+
+// PruningPath holds the steps of minimal cost-complexity pruning. Pruning a
+// tree with a complexity parameter alpha removes the subtrees that do not
+// reduce the cost
+//
+//	R_alpha(T) = R(T) + alpha |T|
+//
+// where R(T) is the total impurity of the leaves, weighted with their share
+// of the sample weight, and |T| the number of leaves. Alphas are the
+// effective alphas at which the subtrees are pruned, the weakest link
+// first, and Impurities the total leaf impurities R(T) of the pruned
+// trees. The first step is the unpruned tree with alpha 0, the last one
+// the root alone.
+type PruningPath struct {
+	Alphas     []float64 `json:"alphas"`
+	Impurities []float64 `json:"impurities"`
+}
+
+// clone returns a deep copy of the node and its descendants.
+func (n *Node) clone() *Node {
+	if n == nil {
+		return nil
+	}
+	cp := *n
+	if n.Dist != nil {
+		cp.Dist = append([]float64(nil), n.Dist...)
+	}
+	cp.Left, cp.Right = n.Left.clone(), n.Right.clone()
+	return &cp
+}
+
+// collapse turns the node into a leaf, which predicts its own label and
+// class distribution.
+func (n *Node) collapse() {
+	n.Left, n.Right = nil, nil
+	n.Split = SplitInfo{}
+}
+
+// cost computes the weighted impurity R(t) of the node as a leaf.
+func (n *Node) cost(total float64) float64 {
+	return n.Weight / total * n.Impurity
+}
+
+// weakLinks collects the inner nodes of the least effective alpha, ie the
+// alpha at which collapsing them costs nothing:
+//
+//	alpha = (R(t) - R(T_t)) / (|T_t| - 1)
+//
+// where T_t is the subtree below the node t.
+type weakLinks struct {
+	alpha float64
+	nodes []*Node
+}
+
+// subtreeCost is a helper method that computes the total weighted impurity
+// of the leaves below the node and their number. If links is not nil, the
+// weakest links among the inner nodes are collected on the way.
+func (n *Node) subtreeCost(total float64, links *weakLinks) (float64, int) {
+	if n.Left == nil {
+		return n.cost(total), 1
+	}
+	leftCost, leftLeaves := n.Left.subtreeCost(total, links)
+	rightCost, rightLeaves := n.Right.subtreeCost(total, links)
+	cost, leaves := leftCost+rightCost, leftLeaves+rightLeaves
+	if links != nil {
+		alpha := (n.cost(total) - cost) / float64(leaves-1)
+		if alpha < links.alpha-1e-12 {
+			links.alpha, links.nodes = alpha, []*Node{n}
+		} else if alpha <= links.alpha+1e-12 {
+			links.nodes = append(links.nodes, n)
+		}
+	}
+	return cost, leaves
+}
+
+// prune is a helper function that collapses the weakest links of the tree
+// below the root until their effective alpha exceeds maxAlpha. If path is
+// not nil, the steps are recorded.
+func prune(root *Node, maxAlpha float64, path *PruningPath) {
+	if root == nil || root.Weight <= 0.0 {
+		return
+	}
+	total := root.Weight
+	if path != nil {
+		cost, _ := root.subtreeCost(total, nil)
+		path.Alphas = append(path.Alphas, 0.0)
+		path.Impurities = append(path.Impurities, cost)
+	}
+	for root.Left != nil {
+		links := &weakLinks{alpha: math.Inf(1)}
+		root.subtreeCost(total, links)
+		if links.alpha > maxAlpha {
+			return
+		}
+		for _, nd := range links.nodes {
+			nd.collapse()
+		}
+		if path != nil {
+			cost, _ := root.subtreeCost(total, nil)
+			path.Alphas = append(path.Alphas, math.Max(links.alpha, 0.0))
+			path.Impurities = append(path.Impurities, cost)
+		}
+	}
+}
+
+// CostComplexityPath computes the pruning path of the tree without changing
+// it. Trees persisted before pruning support lack the node impurities and
+// cannot be pruned; unfitted trees have an empty path.
+func (dt *Tree) CostComplexityPath() PruningPath {
+	var path PruningPath
+	prune(dt.Root.clone(), math.Inf(1), &path)
+	return path
+}
+
+// Prune performs minimal cost-complexity pruning with the complexity
+// parameter alpha: it collapses the weakest links of the tree as long as
+// their effective alpha does not exceed alpha. Pruning with an alpha of the
+// pruning path yields the corresponding tree. The importances are
+// recomputed from the remaining splits.
+func (dt *Tree) Prune(alpha float64) {
+	prune(dt.Root, alpha, nil)
+	dt.recountImportances()
+}
+
+// recountImportances is a helper method that recomputes the importances
+// of a pruned tree from its remaining splits.
+func (dt *Tree) recountImportances() {
+	if dt.Importances != nil && dt.Root != nil && dt.Root.Weight > 0.0 {
+		dt.Importances = make([]float64, len(dt.Importances))
+		decreases(dt.Root, dt.Root.Weight, dt.Importances)
+	}
+}
+
+// pruneCV is a helper method that picks the alpha of the pruning path with
+// the best mean score in k-fold cross-validation. Example i belongs to fold
+// i % k. For every fold, a tree with the same settings is trained on the
+// other folds, pruned with every alpha and scored on the fold. Finally, the
+// tree is trained on all examples and pruned with the best alpha, the
+// greatest one on equal scores.
+func (dt *Tree) pruneCV(dpoints [][]float64, labels []float64, k int, score func(Tree, [][]float64, []float64) float64) float64 {
+	dt.Fit(dpoints, labels)
+	alphas := dt.CostComplexityPath().Alphas
+	scores := make([]float64, len(alphas))
+	for fold := 0; fold < k; fold++ {
+		var trainPts, testPts [][]float64
+		var trainLbs, testLbs []float64
+		for i, dpoint := range dpoints {
+			if i%k == fold {
+				testPts = append(testPts, dpoint)
+				testLbs = append(testLbs, labels[i])
+			} else {
+				trainPts = append(trainPts, dpoint)
+				trainLbs = append(trainLbs, labels[i])
+			}
+		}
+		if len(testPts) == 0 {
+			continue
+		}
+		foldTree := *dt
+		foldTree.Fit(trainPts, trainLbs)
+		for a, alpha := range alphas {
+			pruned := foldTree
+			pruned.Root = foldTree.Root.clone()
+			pruned.Prune(alpha)
+			scores[a] += float64(len(testPts)) * score(pruned, testPts, testLbs)
+		}
+	}
+	best := 0
+	for a := range scores {
+		if scores[a] >= scores[best] {
+			best = a
+		}
+	}
+	dt.Prune(alphas[best])
+	return alphas[best]
+}
+
+// PruneCV trains the classification tree and prunes it with the alpha of
+// the pruning path that achieves the best accuracy in k-fold
+// cross-validation, which it returns.
+func (dt *TreeClassifier) PruneCV(dpoints [][]float64, labels []float64, k int) float64 {
+	if nClasses := NumClasses(labels); nClasses > dt.Classes {
+		dt.Classes = nClasses
+	}
+	return dt.Tree.pruneCV(dpoints, labels, k, func(tree Tree, dpoints [][]float64, labels []float64) float64 {
+		clf := TreeClassifier{Tree: tree}
+		return clf.Score(dpoints, labels)
+	})
+}
+
+// PruneCV trains the regression tree and prunes it with the alpha of the
+// pruning path that achieves the best coefficient of determination in
+// k-fold cross-validation, which it returns.
+func (dt *TreeRegressor) PruneCV(dpoints [][]float64, labels []float64, k int) float64 {
+	return dt.Tree.pruneCV(dpoints, labels, k, func(tree Tree, dpoints [][]float64, labels []float64) float64 {
+		return TreeRegressor{tree}.Score(dpoints, labels)
+	})
+}
+
+// reducedError is a helper function that performs reduced-error pruning
+// bottom-up below the node with the validation examples reaching it, given
+// by their indices. A subtree is collapsed if the node as a leaf makes no
+// more error on them than the (pruned) subtree. It returns the error of
+// the pruned subtree.
+func reducedError(nd *Node, dpoints [][]float64, idx []int, loss func(*Node, int) float64) float64 {
+	if nd == nil {
+		return 0.0
+	}
+	var leafErr float64
+	for _, i := range idx {
+		leafErr += loss(nd, i)
+	}
+	if nd.Left == nil {
+		return leafErr
+	}
+	var left, right []int
+	for _, i := range idx {
+		if nd.Split.goesLeft(dpoints[i]) {
+			left = append(left, i)
+		} else {
+			right = append(right, i)
+		}
+	}
+	subtreeErr := reducedError(nd.Left, dpoints, left, loss) + reducedError(nd.Right, dpoints, right, loss)
+	if leafErr <= subtreeErr {
+		nd.collapse()
+		return leafErr
+	}
+	return subtreeErr
+}
+
+// validation is a helper function that returns the indices of the validation examples.
+func validation(dpoints [][]float64) []int {
+	idx := make([]int, len(dpoints))
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// PruneReducedError prunes the trained classification tree against a
+// validation set: every subtree, from the bottom up, is collapsed if the
+// node as a leaf misclassifies no more of the validation examples
+// reaching it. The importances are recomputed from the remaining splits.
+func (dt *TreeClassifier) PruneReducedError(dpoints [][]float64, labels []float64) {
+	reducedError(dt.Root, dpoints, validation(dpoints), func(nd *Node, i int) float64 {
+		if Argmax(nd.dist()) != Class(labels[i], dt.Classes) {
+			return 1.0
+		}
+		return 0.0
+	})
+	dt.recountImportances()
+}
+
+// PruneReducedError prunes the trained regression tree against a validation
+// set: every subtree, from the bottom up, is collapsed if the node as a leaf
+// makes no greater squared error on the validation examples reaching it.
+// The importances are recomputed from the remaining splits.
+func (dt *TreeRegressor) PruneReducedError(dpoints [][]float64, labels []float64) {
+	reducedError(dt.Root, dpoints, validation(dpoints), func(nd *Node, i int) float64 {
+		diff := nd.Label - labels[i]
+		return diff * diff
+	})
+	dt.recountImportances()
+}
@@ -0,0 +1,117 @@
+package ch09
+
+import (
+	"math"
+	"testing"
+
+	"grokml/pkg/persist"
+)
+
+// noisy is a helper function that returns examples of a threshold rule
+// with some labels flipped.
+func noisy() ([][]float64, []float64) {
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 40; i++ {
+		dpoints = append(dpoints, []float64{float64(i)})
+		label := 0.0
+		if i >= 20 {
+			label = 1.0
+		}
+		if i%9 == 4 { // noise
+			label = 1.0 - label
+		}
+		labels = append(labels, label)
+	}
+	return dpoints, labels
+}
+
+func TestCostComplexityPath(t *testing.T) {
+	dpoints, labels := noisy()
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Fit(dpoints, labels)
+	full := len(leaves(dt.Root))
+
+	path := dt.CostComplexityPath()
+	if len(leaves(dt.Root)) != full {
+		t.Fatal("expected the pruning path to leave the tree untouched")
+	}
+	n := len(path.Alphas)
+	if n < 3 || path.Alphas[0] != 0.0 || path.Impurities[0] > 1e-12 {
+		t.Fatalf("expected a path from a pure tree, got %+v", path)
+	}
+	for i := 1; i < n; i++ {
+		if path.Alphas[i] < path.Alphas[i-1] || path.Impurities[i] < path.Impurities[i-1] {
+			t.Errorf("step %d: expected growing alphas and impurities, got %+v", i, path)
+		}
+	}
+	// The root alone has the Gini impurity of the labels, 1 - 2 (1/2)^2.
+	if math.Abs(path.Impurities[n-1]-0.5) > 1e-9 {
+		t.Errorf("expected impurity 0.5 of the root, got %.4f", path.Impurities[n-1])
+	}
+	// Pruning with the second-last alpha keeps the main split only.
+	dt.Prune(path.Alphas[n-2])
+	if got := len(leaves(dt.Root)); got != 2 || dt.Root.Split.Threshold != 19.5 {
+		t.Errorf("expected the split at 19.5, got %d leaves and %+v", got, dt.Root.Split)
+	}
+	persist.Dump(&dt, "../../models/ch09-tree/pruned.json")
+
+	dt2 := TreeClassifier{}
+	persist.Load(&dt2, "../../models/ch09-tree/pruned.json")
+	if acc := dt2.Score(dpoints, labels); math.Abs(acc-0.9) > 1e-9 {
+		t.Errorf("expected accuracy 0.9 of the pruned tree, got %.4f", acc)
+	}
+	dt2.Prune(math.Inf(1))
+	if dt2.Root.Left != nil {
+		t.Error("expected the root alone")
+	}
+}
+
+func TestPruneCV(t *testing.T) {
+	dpoints, labels := noisy()
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Fit(dpoints, labels)
+	full := len(leaves(dt.Root))
+
+	alpha := dt.PruneCV(dpoints, labels, 5)
+	if alpha <= 0.0 || len(leaves(dt.Root)) >= full {
+		t.Errorf("expected pruning, got alpha %.4f and %d of %d leaves", alpha, len(leaves(dt.Root)), full)
+	}
+
+	dr := NewTreeRegressor(0.0)
+	if alpha := dr.PruneCV(dpoints, labels, 5); alpha < 0.0 || dr.Root == nil {
+		t.Errorf("expected a pruned regression tree, got alpha %.4f", alpha)
+	}
+}
+
+func TestPruneReducedError(t *testing.T) {
+	dpoints, labels := noisy()
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Fit(dpoints, labels)
+	// The validation set follows the rule without noise.
+	valid := make([]float64, len(labels))
+	for i := range valid {
+		if i >= 20 {
+			valid[i] = 1.0
+		}
+	}
+	dt.PruneReducedError(dpoints, valid)
+	if got := len(leaves(dt.Root)); got != 2 {
+		t.Errorf("expected 2 leaves, got %d", got)
+	}
+	if acc := dt.Score(dpoints, valid); acc != 1.0 {
+		t.Errorf("expected validation accuracy 1, got %.4f", acc)
+	}
+}
+
+func TestPruneUnfitted(t *testing.T) {
+	dt := NewTreeClassifier(Gini, 0.0)
+	if path := dt.CostComplexityPath(); len(path.Alphas) != 0 || len(path.Impurities) != 0 {
+		t.Errorf("expected an empty path, got %+v", path)
+	}
+	dt.Prune(0.1)
+	dt.PruneReducedError([][]float64{{1}}, []float64{1})
+	if dt.Root != nil {
+		t.Error("expected the tree to stay unfitted")
+	}
+}
@@ -0,0 +1,150 @@
+package ch09
+
+import (
+	"encoding/json"
+	"sort"
+
+	pl "grokml/pkg/pipeline"
+)
+
+// QuantileForest implements quantile regression forests (Meinshausen, 2006).
+// The trees are trained like those of ForestRegressor, but the forest
+// remembers the labels of all training examples and the leaves they reach.
+// The conditional distribution of the label of a data point is estimated by
+// the training labels weighted by how often they share a leaf with it: in
+// every tree, the examples in the leaf reached by the data point share the
+// weight 1 among them in proportion to their sample weights, and the
+// weights are averaged over the trees. Its quantiles predict the label
+// with intervals, whereas Predict returns the mean of the tree predictions.
+// Leaves holds for every tree the indices of the (flat) leaves reached by
+// the training examples (see FlatTree).
+type QuantileForest struct {
+	ForestRegressor
+	Labels  []float64 `json:"labels"`
+	Weights []float64 `json:"weights"`
+	Leaves  [][]int   `json:"leaves"`
+}
+
+// NewQuantileForest is the constructor function for QuantileForest.
+// Its parameters are the number of trees and the minimum gain.
+func NewQuantileForest(nTrees int, ming float64) *QuantileForest {
+	return &QuantileForest{ForestRegressor: *NewForestRegressor(nTrees, ming)}
+}
+
+// Fit implements the training of the trees and records the leaves of the
+// training examples.
+func (qf *QuantileForest) Fit(dpoints [][]float64, labels []float64) {
+	qf.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted implements the training with sample weights, which also
+// weigh the training labels in the estimated distributions.
+func (qf *QuantileForest) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
+	qf.ForestRegressor.FitWeighted(dpoints, labels, weights)
+	qf.Labels = append([]float64(nil), labels...)
+	qf.Weights = append([]float64(nil), weights...)
+	qf.Leaves = make([][]int, len(qf.Estimators))
+	pl.Parallel(qf.NJobs, len(qf.Estimators), func(t int) {
+		qf.Leaves[t] = qf.flatTree(t).Apply(dpoints)
+	})
+}
+
+// PredictQuantiles estimates the given quantiles, numbers between 0 and 1,
+// of the labels of the data points. The quantile q is the least training
+// label whose cumulative weight reaches q. The result holds the quantiles
+// of every data point in the given order.
+func (qf *QuantileForest) PredictQuantiles(dpoints [][]float64, quantiles []float64) [][]float64 {
+	// the training examples of every leaf and their total weight
+	trees := make([]*FlatTree, len(qf.Estimators))
+	members := make([][][]int, len(qf.Estimators))
+	totals := make([][]float64, len(qf.Estimators))
+	for t := range qf.Estimators {
+		trees[t] = qf.flatTree(t)
+		members[t] = make([][]int, len(trees[t].Nodes))
+		totals[t] = make([]float64, len(trees[t].Nodes))
+		for i, leaf := range qf.Leaves[t] {
+			members[t][leaf] = append(members[t][leaf], i)
+			totals[t][leaf] += qf.Weights[i]
+		}
+	}
+	order := make([]int, len(qf.Labels))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return qf.Labels[order[a]] < qf.Labels[order[b]] })
+	size := float64(len(trees))
+	preds := make([][]float64, len(dpoints))
+	pl.Parallel(qf.NJobs, len(dpoints), func(j int) {
+		weights := make([]float64, len(qf.Labels))
+		for t, tree := range trees {
+			leaf := tree.leaf(dpoints[j])
+			if totals[t][leaf] <= 0.0 {
+				continue
+			}
+			for _, i := range members[t][leaf] {
+				weights[i] += qf.Weights[i] / totals[t][leaf] / size
+			}
+		}
+		preds[j] = make([]float64, len(quantiles))
+		for k, q := range quantiles {
+			preds[j][k] = quantile(order, qf.Labels, weights, q)
+		}
+	})
+	return preds
+}
+
+// quantile is a helper function that returns the least of the labels, in
+// the given order, whose cumulative weight reaches q.
+func quantile(order []int, labels, weights []float64, q float64) float64 {
+	var sum, total float64
+	for _, w := range weights {
+		total += w
+	}
+	var last int
+	for _, i := range order {
+		if weights[i] <= 0.0 {
+			continue
+		}
+		sum += weights[i]
+		last = i
+		if sum >= q*total-1e-12 {
+			return labels[i]
+		}
+	}
+	return labels[last]
+}
+
+// PredictQuantile estimates the quantile q of the labels of the data
+// points, eg their median for q = 0.5.
+func (qf *QuantileForest) PredictQuantile(dpoints [][]float64, q float64) []float64 {
+	preds := make([]float64, len(dpoints))
+	for j, qs := range qf.PredictQuantiles(dpoints, []float64{q}) {
+		preds[j] = qs[0]
+	}
+	return preds
+}
+
+// PredictInterval returns the bounds of the prediction intervals of the
+// data points at the level 1 - alpha, ie their quantiles alpha/2 and
+// 1 - alpha/2.
+func (qf *QuantileForest) PredictInterval(dpoints [][]float64, alpha float64) ([]float64, []float64) {
+	lower := make([]float64, len(dpoints))
+	upper := make([]float64, len(dpoints))
+	for j, qs := range qf.PredictQuantiles(dpoints, []float64{alpha / 2.0, 1.0 - alpha/2.0}) {
+		lower[j], upper[j] = qs[0], qs[1]
+	}
+	return lower, upper
+}
+
+// Marshal and Unmarshal implement the JSONable interface (pkg: persist).
+func (qf QuantileForest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(qf, "", "    ")
+}
+
+func (qf *QuantileForest) Unmarshal(bs []byte) error {
+	if err := json.Unmarshal(bs, qf); err != nil {
+		return err
+	}
+	qf.Compile()
+	return nil
+}
@@ -0,0 +1,72 @@
+package ch09
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// heteroscedastic is a helper function that draws labels whose spread
+// grows with the data point component.
+func heteroscedastic(rng *rand.Rand, n int) ([][]float64, []float64) {
+	dpoints := make([][]float64, n)
+	labels := make([]float64, n)
+	for i := range dpoints {
+		x := rng.Float64() * 10.0
+		dpoints[i] = []float64{x}
+		labels[i] = 5.0 + x*rng.NormFloat64()
+	}
+	return dpoints, labels
+}
+
+func TestQuantileForest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	dpoints, labels := heteroscedastic(rng, 1000)
+	qf := NewQuantileForest(20, 0.0)
+	qf.Seed = 3
+	for _, tree := range qf.Estimators {
+		tree.MinSamplesLeaf = 10
+	}
+	qf.Fit(dpoints, labels)
+
+	testPts, testLbs := heteroscedastic(rng, 1000)
+	lower, upper := qf.PredictInterval(testPts, 0.2)
+	var covered float64
+	for i, label := range testLbs {
+		if lower[i] > upper[i] {
+			t.Fatalf("data point %d: lower bound %.3f above upper bound %.3f", i, lower[i], upper[i])
+		}
+		if lower[i] <= label && label <= upper[i] {
+			covered++
+		}
+	}
+	if cov := covered / float64(len(testLbs)); cov < 0.7 || cov > 0.9 {
+		t.Errorf("expected a coverage of about 0.8, got %.3f", cov)
+	}
+	// The intervals widen with the spread of the labels.
+	lower, upper = qf.PredictInterval([][]float64{{1}, {9}}, 0.2)
+	if upper[0]-lower[0] >= upper[1]-lower[1] {
+		t.Errorf("expected a narrower interval at 1 than at 9, got %.3f and %.3f",
+			upper[0]-lower[0], upper[1]-lower[1])
+	}
+	// Quantiles are ordered.
+	for i, qs := range qf.PredictQuantiles(testPts[:50], []float64{0.1, 0.5, 0.9}) {
+		if qs[0] > qs[1] || qs[1] > qs[2] {
+			t.Errorf("data point %d: expected ordered quantiles, got %v", i, qs)
+		}
+	}
+
+	bs, err := qf.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	qf2 := &QuantileForest{}
+	if err := qf2.Unmarshal(bs); err != nil {
+		t.Fatal(err)
+	}
+	exp, got := qf.PredictQuantile(testPts, 0.5), qf2.PredictQuantile(testPts, 0.5)
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("data point %d: expected median %v, got %v", i, exp[i], got[i])
+		}
+	}
+}
@@ -3,15 +3,77 @@ package ch09
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
 
 	pl "grokml/pkg/pipeline"
 )
 
-// Tree implements a binary tree structure.
+// Tree implements a binary tree structure. Its growth is controlled by
+// the minimum gain and the stopping rules of the embedded Limits.
+// If MaxBins is positive, the data point components are bucketed into at
+// most MaxBins quantile bins once before training and splits are searched
+// on per-node histograms, which is much faster on large data sets.
+// MaxBins of zero searches all split points exactly. Classification trees
+// store the class distributions of the Classes classes in their nodes.
+// ColSampleLevel is the share of dimensions searched per level by
+// second-order trees (see FitNewton). MaxFeatures limits the number of
+// dimensions searched per split (see NumFeatures), which are drawn with
+// the random seed Seed. With RandomSplits, a split tries a single random
+// threshold per dimension, as extremely randomized trees do, and MaxBins
+// is ignored. Categorical marks the dimensions that hold categories, eg
+// codes 1, 2, 3 for the passenger class, which are split into subsets of
+// categories rather than at thresholds. Importances holds the impurity
+// decreases achieved by the splits of every dimension (see
+// FeatureImportances). NJobs is the number of goroutines searching the
+// dimensions for splits (see pipeline.Parallel); the tree does not depend on it.
 type Tree struct {
-	Root    *Node    `json:"root"`
-	Imp     Impurity `json:"-"`
-	MinGain float64
+	Root           *Node    `json:"root"`
+	Imp            Impurity `json:"-"`
+	MinGain        float64
+	MaxBins        int       `json:"max_bins"`
+	Classes        int       `json:"classes,omitempty"`
+	ColSampleLevel float64   `json:"colsample_level,omitempty"`
+	MaxFeatures    string    `json:"max_features,omitempty"`
+	Seed           int64     `json:"seed,omitempty"`
+	NJobs          int       `json:"n_jobs,omitempty"`
+	RandomSplits   bool      `json:"random_splits,omitempty"`
+	Categorical    []bool    `json:"categorical,omitempty"`
+	Importances    []float64 `json:"importances,omitempty"`
+	Limits
+}
+
+// NumFeatures returns the number of the nDims dimensions that a split
+// searches according to the spec: "sqrt" or "log2" of nDims, a fraction of
+// nDims (a number up to 1) or a count (a greater number). An empty spec or
+// "all" searches all dimensions. NumFeatures panics if the spec is invalid.
+func NumFeatures(spec string, nDims int) int {
+	var num int
+	switch spec {
+	case "", "all":
+		return nDims
+	case "sqrt":
+		num = int(math.Sqrt(float64(nDims)))
+	case "log2":
+		num = int(math.Log2(float64(nDims)))
+	default:
+		val, err := strconv.ParseFloat(spec, 64)
+		if err != nil || val <= 0.0 {
+			panic(fmt.Sprintf("invalid max features %q", spec))
+		}
+		if val <= 1.0 {
+			num = int(val * float64(nDims))
+		} else {
+			num = int(val)
+		}
+	}
+	if num < 1 {
+		return 1
+	} else if num > nDims {
+		return nDims
+	}
+	return num
 }
 
 // TreeClassifier implements a decision tree for classification.
@@ -45,25 +107,66 @@ func (dt Tree) String() string {
 // on the embedded Tree struct inside a classification tree or
 // regression tree.
 func (dt *Tree) Fit(dpoints [][]float64, labels []float64) {
+	dt.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted performs the training of a tree with sample weights. The
+// impurities, gains and leaf values are computed from the weighted label
+// statistics, whereas the sample limits count examples.
+func (dt *Tree) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
 	examples := MakeExamples(dpoints, labels)
+	for i, w := range weights {
+		examples[i].weight = w
+	}
+	if dt.Classes > 0 {
+		for i, label := range labels {
+			examples[i].class = Class(label, dt.Classes)
+		}
+	}
 	dt.Root = NewNode(0, dt.MinGain)
-	dt.Root.Fit(examples, dt.Imp)
+	g := &grower{imp: dt.Imp, lim: dt.Limits, classes: dt.Classes, jobs: dt.NJobs, random: dt.RandomSplits}
+	g.categorical = dt.Categorical
+	if dt.MaxFeatures != "" || dt.RandomSplits {
+		g.rng = rand.New(rand.NewSource(dt.Seed))
+		g.maxFeatures = NumFeatures(dt.MaxFeatures, len(dpoints[0]))
+	}
+	if dt.MaxBins > 0 && !dt.RandomSplits {
+		g.bins = NewBins(dpoints, dt.MaxBins)
+		g.bins.encode(examples)
+	}
+	g.grow(dt.Root, examples)
+	dt.Importances = g.importances
+}
+
+// leaf returns the leaf reached by the data point.
+func (dt Tree) leaf(dpoint []float64) *Node {
+	nd := dt.Root
+	// Loop until you hit a leaf.
+	for nd.Left != nil {
+		if nd.Split.goesLeft(dpoint) {
+			nd = nd.Left
+		} else {
+			nd = nd.Right
+		}
+	}
+	return nd
+}
+
+// Apply returns the leaves reached by the data points, eg to refine their
+// labels after training.
+func (dt Tree) Apply(dpoints [][]float64) []*Node {
+	leaves := make([]*Node, len(dpoints))
+	for i, dpoint := range dpoints {
+		leaves[i] = dt.leaf(dpoint)
+	}
+	return leaves
 }
 
 // Predict implements the inference of the labels for the given data points.
 func (dt Tree) Predict(dpoints [][]float64) []float64 {
 	labels := make([]float64, len(dpoints))
 	for i, dpoint := range dpoints {
-		nd := dt.Root
-		// Loop until you hit a leaf.
-		for nd.Left != nil {
-			if dpoint[nd.Split.Dimension] < nd.Split.Threshold {
-				nd = nd.Left
-			} else {
-				nd = nd.Right
-			}
-		}
-		labels[i] = nd.Label
+		labels[i] = dt.leaf(dpoint).Label
 	}
 	return labels
 }
@@ -77,11 +180,87 @@ func (dt *Tree) Unmarshal(bs []byte) error {
 	return json.Unmarshal(bs, dt)
 }
 
+// NumClasses returns the number of classes of the labels, which are the
+// class indices 0, 1, ..., K-1. There are at least two classes.
+func NumClasses(labels []float64) int {
+	nClasses := 2
+	for _, label := range labels {
+		if int(label)+1 > nClasses {
+			nClasses = int(label) + 1
+		}
+	}
+	return nClasses
+}
+
+// Class returns the class index of a label. With two classes, labels are
+// turned binary by the threshold 0.5, so that labels such as probabilities
+// can be used as well.
+func Class(label float64, nClasses int) int {
+	if nClasses <= 2 {
+		if label > threshold {
+			return 1
+		}
+		return 0
+	}
+	return int(label)
+}
+
+// Fit trains the classification tree on labels that are the class indices
+// 0, 1, ..., K-1. Classes is raised to the number of classes found, so a
+// forest can set it beforehand in case some classes are missing in a sample.
+func (dt *TreeClassifier) Fit(dpoints [][]float64, labels []float64) {
+	dt.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted trains the classification tree with sample weights. The leaf
+// distributions hold the weight share of the classes.
+func (dt *TreeClassifier) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
+	if nClasses := NumClasses(labels); nClasses > dt.Classes {
+		dt.Classes = nClasses
+	}
+	dt.Tree.FitWeighted(dpoints, labels, weights)
+}
+
+// Predict returns the majority classes of the leaves reached by the data points.
+func (dt TreeClassifier) Predict(dpoints [][]float64) []float64 {
+	labels := make([]float64, len(dpoints))
+	for i, dist := range dt.PredictDist(dpoints) {
+		labels[i] = float64(Argmax(dist))
+	}
+	return labels
+}
+
+// PredictDist returns the class distributions of the leaves reached by the
+// data points.
+func (dt TreeClassifier) PredictDist(dpoints [][]float64) [][]float64 {
+	dists := make([][]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		dists[i] = dt.leaf(dpoint).dist()
+	}
+	return dists
+}
+
+// PredictProba returns the relative frequency of positive examples (class 1)
+// in the leaves reached by the data points as their probability of the
+// positive class.
+func (dt TreeClassifier) PredictProba(dpoints [][]float64) []float64 {
+	probs := make([]float64, len(dpoints))
+	for i, dist := range dt.PredictDist(dpoints) {
+		probs[i] = dist[1]
+	}
+	return probs
+}
+
+// PredictClass labels the data points whose probability exceeds the threshold with 1.
+func (dt TreeClassifier) PredictClass(dpoints [][]float64, threshold float64) []float64 {
+	return pl.Classify(dt.PredictProba(dpoints), threshold)
+}
+
 // Score computes the quantities necessary to populate a Report struct and
 // returns the accuracy.
 func (dt *TreeClassifier) Score(dpoints [][]float64, labels []float64) float64 {
 	predictions := dt.Predict(dpoints)
-	dt.Report = pl.GetReport(predictions, labels)
+	dt.Report = report(predictions, labels, dt.Classes)
 	return dt.Report.Accuracy
 }
 
@@ -91,3 +270,23 @@ func (dt TreeRegressor) Score(dpoints [][]float64, labels []float64) float64 {
 	predictions := dt.Predict(dpoints)
 	return pl.GetCoD(predictions, labels)
 }
+
+// Argmax returns the index of the greatest value, the first one in case of ties.
+func Argmax(vals []float64) int {
+	var best int
+	for k, val := range vals {
+		if val > vals[best] {
+			best = k
+		}
+	}
+	return best
+}
+
+// report is a helper function that computes the binary report for two
+// classes and the macro-averaged multiclass report for more.
+func report(predictions []float64, labels []float64, nClasses int) pl.Report {
+	if nClasses > 2 {
+		return pl.GetMultiReport(predictions, labels)
+	}
+	return pl.GetReport(predictions, labels)
+}
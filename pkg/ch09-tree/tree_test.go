@@ -4,6 +4,7 @@ import (
 	"math"
 	"testing"
 
+	ds "grokml/pkg/dataset"
 	"grokml/pkg/persist"
 )
 
@@ -18,7 +19,7 @@ func TestTreeEntropy(t *testing.T) {
 	dt.Fit(dpoints, labels)
 	dt.Score(dpoints, labels)
 	rep := dt.Report
-	exp := 0.9230769
+	exp := 1.0
 	if math.Abs(rep.FScore(1.0)-exp) > 1e-5 {
 		t.Errorf("expected F-score %.7f, got %.7f", exp, rep.FScore(1.0))
 	}
@@ -44,7 +45,7 @@ func TestTreeGini(t *testing.T) {
 	dt.Fit(dpoints, labels)
 	dt.Score(dpoints, labels)
 	rep := dt.Report
-	exp := 0.9230769
+	exp := 1.0
 	if math.Abs(rep.FScore(1.0)-exp) > 1e-5 {
 		t.Errorf("expected F-score %.7f, got %.7f", exp, rep.FScore(1.0))
 	}
@@ -79,3 +80,230 @@ func TestTreeMSE(t *testing.T) {
 		t.Errorf("expected R2 score %.7f, got %.7f", exp, got)
 	}
 }
+
+// leaves is a helper function that collects the leaves below a node.
+func leaves(nd *Node) []*Node {
+	if nd.Left == nil {
+		return []*Node{nd}
+	}
+	return append(leaves(nd.Left), leaves(nd.Right)...)
+}
+
+func TestTreeLimits(t *testing.T) {
+	dpoints := [][]float64{
+		{7, 1}, {3, 2}, {2, 3}, {1, 5}, {2, 6}, {4, 7},
+		{1, 9}, {8, 10}, {6, 5}, {7, 8}, {8, 4}, {9, 6},
+	}
+	labels := []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1}
+
+	cases := []struct {
+		limits Limits
+		check  func(lvs []*Node) bool
+	}{
+		{Limits{MaxDepth: 1}, func(lvs []*Node) bool {
+			return len(lvs) == 2 && lvs[0].Depth == 1
+		}},
+		{Limits{MinSamplesLeaf: 4}, func(lvs []*Node) bool {
+			for _, lf := range lvs {
+				if lf.Samples < 4 {
+					return false
+				}
+			}
+			return true
+		}},
+		{Limits{MinSamplesSplit: 13}, func(lvs []*Node) bool {
+			return len(lvs) == 1 && lvs[0].Label == 0.5
+		}},
+		{Limits{MaxLeafNodes: 3}, func(lvs []*Node) bool {
+			return len(lvs) == 3
+		}},
+		{Limits{MinImpurityDecrease: 0.5}, func(lvs []*Node) bool {
+			return len(lvs) == 1
+		}},
+	}
+	for _, c := range cases {
+		dt := NewTreeClassifier(Gini, 0.0)
+		dt.Limits = c.limits
+		dt.Fit(dpoints, labels)
+		if lvs := leaves(dt.Root); !c.check(lvs) {
+			t.Errorf("limits %+v violated by %d leaves", c.limits, len(lvs))
+		}
+	}
+	// The limits are persisted.
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Limits = Limits{MaxDepth: 2, MinSamplesLeaf: 2, MaxLeafNodes: 3}
+	dt.Fit(dpoints, labels)
+	bs, _ := dt.Marshal()
+	dt2 := TreeClassifier{}
+	dt2.Unmarshal(bs)
+	if dt2.Limits != dt.Limits {
+		t.Errorf("expected limits %+v, got %+v", dt.Limits, dt2.Limits)
+	}
+}
+
+func TestTreeHistogram(t *testing.T) {
+	dpoints := [][]float64{
+		{7, 1}, {3, 2}, {2, 3}, {1, 5}, {2, 6}, {4, 7},
+		{1, 9}, {8, 10}, {6, 5}, {7, 8}, {8, 4}, {9, 6},
+	}
+	labels := []float64{0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 1, 1}
+
+	// With enough bins, the bin edges are the exact split points.
+	exact := NewTreeRegressor(0.0)
+	exact.Fit(dpoints, labels)
+	binned := NewTreeRegressor(0.0)
+	binned.MaxBins = 16
+	binned.Fit(dpoints, labels)
+	want, got := exact.Predict(dpoints), binned.Predict(dpoints)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("example %d: expected %.3f, got %.3f", i, want[i], got[i])
+		}
+	}
+	// The number of bins is limited.
+	bins := NewBins(dpoints, 4)
+	for d, edges := range bins.Edges {
+		if len(edges) >= 4 {
+			t.Errorf("dimension %d: expected at most 3 edges, got %v", d, edges)
+		}
+		for _, dpoint := range dpoints {
+			if code := bins.Code(d, dpoint[d]); int(code) > len(edges) {
+				t.Errorf("dimension %d: code %d out of range", d, code)
+			}
+		}
+	}
+	// MaxBins is persisted.
+	bs, _ := binned.Marshal()
+	reg := TreeRegressor{}
+	reg.Unmarshal(bs)
+	if reg.MaxBins != binned.MaxBins {
+		t.Errorf("expected %d bins, got %d", binned.MaxBins, reg.MaxBins)
+	}
+}
+
+func TestTreeMulticlass(t *testing.T) {
+	dpoints := [][]float64{
+		{1, 1}, {2, 1}, {1, 2}, {2, 2},
+		{8, 1}, {9, 1}, {8, 2}, {9, 2},
+		{5, 8}, {6, 8}, {5, 9}, {6, 9},
+	}
+	labels := []float64{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2}
+
+	for _, imp := range []Impurity{Gini, Entropy} {
+		dt := NewTreeClassifier(imp, 0.0)
+		dt.Fit(dpoints, labels)
+		if dt.Classes != 3 {
+			t.Errorf("expected 3 classes, got %d", dt.Classes)
+		}
+		if acc := dt.Score(dpoints, labels); acc != 1.0 {
+			t.Errorf("expected accuracy 1, got %.4f", acc)
+		}
+		if rec := dt.Report.Recall; rec != 1.0 {
+			t.Errorf("expected macro recall 1, got %.4f", rec)
+		}
+		dist := dt.PredictDist([][]float64{{5.5, 8.5}})[0]
+		if len(dist) != 3 || dist[2] != 1.0 {
+			t.Errorf("expected distribution [0 0 1], got %v", dist)
+		}
+	}
+}
+
+func TestTreeFitWeighted(t *testing.T) {
+	dpoints := [][]float64{{1}, {2}, {3}, {4}}
+	labels := []float64{1, 2, 5, 6}
+
+	// Weights count like repeated examples.
+	dt := NewTreeRegressor(0.0)
+	dt.Limits = Limits{MaxDepth: 1}
+	dt.FitWeighted(dpoints, labels, []float64{1, 3, 1, 1})
+	rep := NewTreeRegressor(0.0)
+	rep.Limits = Limits{MaxDepth: 1}
+	rep.Fit([][]float64{{1}, {2}, {2}, {2}, {3}, {4}}, []float64{1, 2, 2, 2, 5, 6})
+	want, got := rep.Predict(dpoints), dt.Predict(dpoints)
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			t.Errorf("example %d: expected %.3f, got %.3f", i, want[i], got[i])
+		}
+	}
+	// Examples of weight zero do not count.
+	clf := NewTreeClassifier(Gini, 0.0)
+	clf.FitWeighted(dpoints, []float64{0, 0, 1, 1}, []float64{1, 1, 1, 0})
+	if dist := clf.PredictDist([][]float64{{4}})[0]; dist[1] != 1.0 {
+		t.Errorf("expected distribution [0 1], got %v", dist)
+	}
+}
+
+func BenchmarkTreeFit(b *testing.B) {
+	csv := ds.NewCSVReader("../../data/titanic.csv", "Survived")
+	dset := ds.NewDataSet(csv, ds.AtoF)
+	dpoints, labels := dset.DPoints(), dset.Labels()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dt := NewTreeClassifier(Gini, 0.0)
+		dt.Fit(dpoints, labels)
+	}
+}
+
+func BenchmarkTreeFitHistogram(b *testing.B) {
+	csv := ds.NewCSVReader("../../data/titanic.csv", "Survived")
+	dset := ds.NewDataSet(csv, ds.AtoF)
+	dpoints, labels := dset.DPoints(), dset.Labels()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dt := NewTreeClassifier(Gini, 0.0)
+		dt.MaxBins = MaxBins
+		dt.Fit(dpoints, labels)
+	}
+}
+
+func TestNumFeatures(t *testing.T) {
+	specs := []string{"", "all", "sqrt", "log2", "0.5", "3", "0.01"}
+	exp := []int{16, 16, 4, 4, 8, 3, 1}
+	for i, spec := range specs {
+		if got := NumFeatures(spec, 16); got != exp[i] {
+			t.Errorf("%q: expected %d features, got %d", spec, exp[i], got)
+		}
+	}
+}
+
+func TestTreeCategorical(t *testing.T) {
+	// Categories 1 and 3 belong to class 1, which no single threshold separates.
+	dpoints := [][]float64{
+		{1, 5}, {2, 3}, {3, 4}, {4, 1}, {1, 2}, {2, 6},
+		{3, 7}, {4, 8}, {1, 9}, {2, 2}, {3, 1}, {4, 4},
+	}
+	labels := []float64{1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0}
+
+	dt := NewTreeClassifier(Gini, 0.0)
+	dt.Categorical = []bool{true, false}
+	dt.Limits.MaxDepth = 1
+	dt.Fit(dpoints, labels)
+	split := dt.Root.Split
+	// The categories of the lower mean label go left.
+	if split.Dimension != 0 || len(split.Categories) != 2 || split.Categories[0] != 2 || split.Categories[1] != 4 {
+		t.Fatalf("expected categories [2 4] to go left, got %+v", split)
+	}
+	if acc := dt.Score(dpoints, labels); acc != 1.0 {
+		t.Errorf("expected accuracy 1, got %.4f", acc)
+	}
+	persist.Dump(&dt, "../../models/ch09-tree/categorical.json")
+
+	dt2 := TreeClassifier{}
+	persist.Load(&dt2, "../../models/ch09-tree/categorical.json")
+	got := dt2.Predict([][]float64{{3, 0}, {4, 0}, {5, 0}})
+	exp := []float64{1, 0, 1} // unknown categories go right
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("example %d: expected class %v, got %v", i, exp[i], got[i])
+		}
+	}
+
+	// Regression sorts the categories by their mean label.
+	reg := NewTreeRegressor(0.0)
+	reg.Categorical = []bool{true, false}
+	reg.Limits.MaxDepth = 1
+	reg.Fit(dpoints, []float64{10, 0, 10, 0, 10, 0, 10, 0, 10, 0, 10, 0})
+	if r2 := reg.Score(dpoints, []float64{10, 0, 10, 0, 10, 0, 10, 0, 10, 0, 10, 0}); r2 != 1.0 {
+		t.Errorf("expected R2 of 1, got %.4f with %+v", r2, reg.Root.Split)
+	}
+}
@@ -8,66 +8,318 @@ import (
 	pl "grokml/pkg/pipeline"
 )
 
-// AdaBoostClassifier implements a forest classifier with AdaBoost.
+// Boosting algorithms of AdaBoostClassifier.
+const (
+	// SAMME weights the class votes of the trees with coefficients computed
+	// from their weighted errors. For two classes, it is discrete AdaBoost.
+	SAMME = "SAMME"
+	// SAMMER (SAMME.R) lets the trees vote with the logarithms of their class
+	// probabilities. For two classes, it is real AdaBoost.
+	SAMMER = "SAMME.R"
+)
+
+// eps keeps probabilities away from zero before taking logarithms.
+const eps = 1e-10
+
+// AdaBoostClassifier implements a forest classifier with AdaBoost. The trees
+// are trained one after another on reweighted examples: the examples
+// misclassified by a tree gain weight for the next one. MaxDepth limits the
+// depth of the trees (1 for decision stumps, 0 for no limit) and LRate
+// shrinks the contribution of every tree.
 type AdaBoostClassifier struct {
 	ch09.Forest
-	Coeffs []float64 `json:"coeffs"`
+	Coeffs    []float64 `json:"coeffs"`
+	Algorithm string    `json:"algorithm"`
+	MaxDepth  int       `json:"max_depth"`
+	LRate     float64   `json:"lrate"`
 }
 
 // NewAdaBoostClassifier is the constructor function for AdaBoostClassifier.
-// Parameters are the same as for NewForestClassifier.
+// Parameters are the same as for NewForestClassifier. It boosts decision
+// stumps with SAMME and no shrinkage.
 func NewAdaBoostClassifier(nTrees int, imp ch09.Impurity, ming float64) *AdaBoostClassifier {
 	trees := make([]*ch09.TreeClassifier, nTrees)
 	for i, _ := range trees {
 		clf := ch09.NewTreeClassifier(imp, ming)
 		trees[i] = &clf
 	}
-	return &AdaBoostClassifier{ch09.Forest{Size: nTrees, Estimators: trees}, nil}
+	return &AdaBoostClassifier{
+		Forest:    ch09.Forest{Size: nTrees, Estimators: trees},
+		Algorithm: SAMME,
+		MaxDepth:  1,
+		LRate:     1.0,
+	}
 }
 
-// Fit implements the training of the tree classifiers where the coefficients
-// are assigned a value known as log-odds which is computed based on the
-// accuracy of the corresponding tree on the training set.
+// Fit implements the training of the tree classifiers. Every tree is fitted
+// to the examples weighted such that those misclassified by its predecessors
+// weigh more. With SAMME, a tree's coefficient is the log-odds of its
+// weighted accuracy plus log(K-1) for K classes, so that trees better than
+// random guessing receive positive coefficients. With SAMME.R, the trees
+// vote with their class probabilities instead. Boosting stops early once a
+// tree classifies all examples correctly or is no better than random
+// guessing (weighted error 0.5 for two classes). The forest then holds
+// fewer trees.
 func (ad *AdaBoostClassifier) Fit(dpoints [][]float64, labels []float64) {
-	ad.Coeffs = make([]float64, ad.Size)
+	ad.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted implements the training with the given initial sample weights.
+func (ad *AdaBoostClassifier) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
+	defer ad.Compile()
+	ad.Classes = ch09.NumClasses(labels)
+	nClasses := float64(ad.Classes)
+	lrate := ad.lrate()
+	sweights := make([]float64, len(weights))
+	copy(sweights, weights)
+	normalise(sweights)
+	ad.Coeffs = make([]float64, 0, ad.Size)
 	for i, tree := range ad.Estimators {
-		tree.Fit(dpoints, labels)
-		acc := tree.Score(dpoints, labels)
-		// make acc reasonable to protect the log
-		if acc > 0.9999 {
-			acc = 0.9999
-		} else if acc < 0.0001 {
-			acc = 0.0001
+		tree.Classes = ad.Classes
+		tree.Limits.MaxDepth = ad.MaxDepth
+		tree.FitWeighted(dpoints, labels, sweights)
+		preds := tree.Predict(dpoints)
+		var wrong float64
+		for j, pred := range preds {
+			if int(pred) != ch09.Class(labels[j], ad.Classes) {
+				wrong += sweights[j]
+			}
+		}
+		if wrong >= 1.0-1.0/nClasses {
+			// no better than guessing: drop the tree unless it is the only one
+			if i == 0 {
+				ad.Coeffs = append(ad.Coeffs, 1.0)
+				i++
+			}
+			ad.truncate(i)
+			return
 		}
-		ad.Coeffs[i] = math.Log(acc / (1.0 - acc))
+		if wrong <= 0.0 {
+			// perfect fit: no need for more trees
+			ad.Coeffs = append(ad.Coeffs, 1.0)
+			ad.truncate(i + 1)
+			return
+		}
+		if ad.Algorithm == SAMMER {
+			ad.Coeffs = append(ad.Coeffs, 1.0)
+			// w *= exp(-lrate (K-1)/K y.log(p)) where y is 1 for the true
+			// class and -1/(K-1) for the others
+			for j, dist := range tree.PredictDist(dpoints) {
+				var dot float64
+				for k, p := range dist {
+					logp := math.Log(math.Max(p, eps))
+					if k == ch09.Class(labels[j], ad.Classes) {
+						dot += logp
+					} else {
+						dot -= logp / (nClasses - 1.0)
+					}
+				}
+				sweights[j] *= math.Exp(-lrate * (nClasses - 1.0) / nClasses * dot)
+			}
+		} else {
+			coeff := lrate * (math.Log((1.0-wrong)/wrong) + math.Log(nClasses-1.0))
+			ad.Coeffs = append(ad.Coeffs, coeff)
+			for j, pred := range preds {
+				if int(pred) != ch09.Class(labels[j], ad.Classes) {
+					sweights[j] *= math.Exp(coeff)
+				}
+			}
+		}
+		normalise(sweights)
 	}
 }
 
-// Predict maps the predictions of each tree classifier into the interval
-// [-1, 1] and computes their linear combination weighted with the
-// associated log-odds.
-func (ad *AdaBoostClassifier) Predict(dpoints [][]float64) []float64 {
-	preds := make([]float64, len(dpoints))
-	for i, tree := range ad.Estimators {
-		for j, pred := range tree.Predict(dpoints) {
-			preds[j] += ad.Coeffs[i] * (2*pred - 1.0)
+// truncate is a helper method that keeps the first size trees only.
+func (ad *AdaBoostClassifier) truncate(size int) {
+	ad.Estimators = ad.Estimators[:size]
+	ad.Size = size
+}
+
+// lrate returns the learning rate, which defaults to 1.
+func (ad *AdaBoostClassifier) lrate() float64 {
+	if ad.LRate <= 0.0 {
+		return 1.0
+	}
+	return ad.LRate
+}
+
+// stage adds the votes of the i-th tree to the class scores of the data points.
+// With SAMME, a tree gives its coefficient to the predicted class. With
+// SAMME.R, it gives (K-1)(log p_k - mean_j log p_j) to every class k.
+func (ad *AdaBoostClassifier) stage(i int, dpoints [][]float64, scores [][]float64) {
+	if ad.Algorithm != SAMMER {
+		for j, pred := range ad.PredictTree(i, dpoints) {
+			scores[j][int(pred)] += ad.Coeffs[i]
 		}
+		return
 	}
-	for j, pred := range preds {
-		if pred < 0.0 {
-			preds[j] = 0.0
-		} else {
-			preds[j] = 1.0
+	nClasses := float64(len(scores[0]))
+	for j, dist := range ad.PredictTreeDist(i, dpoints) {
+		var mean float64
+		logs := make([]float64, len(scores[j]))
+		for k := range logs {
+			if k < len(dist) {
+				logs[k] = math.Log(math.Max(dist[k], eps))
+			} else {
+				logs[k] = math.Log(eps)
+			}
+			mean += logs[k] / nClasses
+		}
+		for k, logp := range logs {
+			scores[j][k] += (nClasses - 1.0) * (logp - mean)
+		}
+	}
+}
+
+// newScores is a helper method that allocates the class scores.
+func (ad *AdaBoostClassifier) newScores(size int) [][]float64 {
+	nClasses := ad.Classes
+	if nClasses < 2 { // persisted before multiclass support
+		nClasses = 2
+	}
+	scores := make([][]float64, size)
+	for j := range scores {
+		scores[j] = make([]float64, nClasses)
+	}
+	return scores
+}
+
+// stages computes the votes of every tree, with NJobs goroutines polling
+// the trees (see pipeline.Parallel).
+func (ad *AdaBoostClassifier) stages(dpoints [][]float64) [][][]float64 {
+	votes := make([][][]float64, len(ad.Estimators))
+	pl.Parallel(ad.NJobs, len(ad.Estimators), func(i int) {
+		votes[i] = ad.newScores(len(dpoints))
+		ad.stage(i, dpoints, votes[i])
+	})
+	return votes
+}
+
+// accumulate is a helper function that adds the votes of a tree to the
+// class scores.
+func accumulate(scores, votes [][]float64) {
+	for j, vote := range votes {
+		for k, v := range vote {
+			scores[j][k] += v
 		}
 	}
+}
+
+// scores computes for every data point and class the sum of the votes of
+// all trees. The votes are added up in the order of the trees.
+func (ad *AdaBoostClassifier) scores(dpoints [][]float64) [][]float64 {
+	scores := ad.newScores(len(dpoints))
+	for _, votes := range ad.stages(dpoints) {
+		accumulate(scores, votes)
+	}
+	return scores
+}
+
+// classify is a helper function that labels every data point with the class
+// of the greatest score. For two classes, ties go to class 1.
+func classify(scores [][]float64) []float64 {
+	preds := make([]float64, len(scores))
+	for j, score := range scores {
+		if len(score) == 2 {
+			if score[1] >= score[0] {
+				preds[j] = 1.0
+			}
+			continue
+		}
+		preds[j] = float64(ch09.Argmax(score))
+	}
 	return preds
 }
 
+// Predict labels the data points with the class of the greatest score. For
+// two classes, these are the data points with a non-negative decision
+// value that are labelled with 1.
+func (ad *AdaBoostClassifier) Predict(dpoints [][]float64) []float64 {
+	return classify(ad.scores(dpoints))
+}
+
+// StagedPredict returns the predictions after each boosting round, ie the
+// predictions of the first 1, 2, ..., Size trees, eg for error curves.
+func (ad *AdaBoostClassifier) StagedPredict(dpoints [][]float64) [][]float64 {
+	scores := ad.newScores(len(dpoints))
+	staged := make([][]float64, len(ad.Estimators))
+	for i, votes := range ad.stages(dpoints) {
+		accumulate(scores, votes)
+		staged[i] = classify(scores)
+	}
+	return staged
+}
+
+// StagedScore returns the accuracies after each boosting round.
+func (ad *AdaBoostClassifier) StagedScore(dpoints [][]float64, labels []float64) []float64 {
+	staged := ad.StagedPredict(dpoints)
+	accs := make([]float64, len(staged))
+	for i, preds := range staged {
+		var correct float64
+		for j, pred := range preds {
+			if int(pred) == ch09.Class(labels[j], ad.Classes) {
+				correct++
+			}
+		}
+		accs[i] = correct / float64(len(labels))
+	}
+	return accs
+}
+
+// PredictDist turns the class scores into class distributions with the
+// softmax function applied to the scores divided by K-1.
+func (ad *AdaBoostClassifier) PredictDist(dpoints [][]float64) [][]float64 {
+	dists := ad.scores(dpoints)
+	for _, dist := range dists {
+		nClasses := float64(len(dist))
+		max := dist[ch09.Argmax(dist)]
+		var sum float64
+		for k, score := range dist {
+			dist[k] = math.Exp((score - max) / (nClasses - 1.0))
+			sum += dist[k]
+		}
+		for k := range dist {
+			dist[k] /= sum
+		}
+	}
+	return dists
+}
+
+// PredictProba returns the probabilities of the positive class (class 1).
+// For two classes, it is the logistic function of the decision value, ie
+// the difference of the class scores.
+func (ad *AdaBoostClassifier) PredictProba(dpoints [][]float64) []float64 {
+	probs := make([]float64, len(dpoints))
+	for j, dist := range ad.PredictDist(dpoints) {
+		probs[j] = dist[1]
+	}
+	return probs
+}
+
+// PredictClass labels the data points whose probability exceeds the threshold with 1.
+func (ad *AdaBoostClassifier) PredictClass(dpoints [][]float64, threshold float64) []float64 {
+	return pl.Classify(ad.PredictProba(dpoints), threshold)
+}
+
+// FeatureImportances averages the normalised importances of the trees,
+// weighted with their coefficients.
+func (ad *AdaBoostClassifier) FeatureImportances() []float64 {
+	importances := make([][]float64, len(ad.Estimators))
+	for t, tree := range ad.Estimators {
+		importances[t] = tree.Importances
+	}
+	return ch09.AverageImportances(importances, ad.Coeffs)
+}
+
 // Score implements the Estimator interface and additionally computes the
 // quantities of a Report struct.
 func (ad *AdaBoostClassifier) Score(dpoints [][]float64, labels []float64) float64 {
 	predictions := ad.Predict(dpoints)
-	ad.Report = pl.GetReport(predictions, labels)
+	if ad.Classes > 2 {
+		ad.Report = pl.GetMultiReport(predictions, labels)
+	} else {
+		ad.Report = pl.GetReport(predictions, labels)
+	}
 	return ad.Report.Accuracy
 }
 
@@ -77,5 +329,20 @@ func (ad AdaBoostClassifier) Marshal() ([]byte, error) {
 }
 
 func (ad *AdaBoostClassifier) Unmarshal(bs []byte) error {
-	return json.Unmarshal(bs, ad)
+	if err := json.Unmarshal(bs, ad); err != nil {
+		return err
+	}
+	ad.Compile()
+	return nil
+}
+
+// normalise is a helper function that scales the weights to sum up to 1.
+func normalise(weights []float64) {
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	for i := range weights {
+		weights[i] /= sum
+	}
 }
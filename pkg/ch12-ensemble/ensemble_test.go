@@ -19,31 +19,102 @@ func TestAdaBoostClassifier(t *testing.T) {
 	ac.Fit(dpoints, labels)
 	ac.Score(dpoints, labels)
 	rep := ac.Report
-	exp := 0.9230769
+	exp := 1.0
 	if math.Abs(rep.FScore(1.0)-exp) > 1e-5 {
 		t.Errorf("expected F-score %.7f, got %.7f", exp, rep.FScore(1.0))
 		t.Errorf("Report %v", rep)
 	}
+	// Classes at threshold 0.5 agree with Predict.
+	preds := ac.Predict(dpoints)
+	for i, label := range ac.PredictClass(dpoints, 0.5) {
+		if label != preds[i] {
+			t.Errorf("expected class %v, got %v", preds[i], label)
+		}
+	}
 	persist.Dump(ac, "../../models/ch09-tree/adaBoost.json")
 
 	ac2 := &AdaBoostClassifier{}
 	persist.Load(ac2, "../../models/ch09-tree/adaBoost.json")
 	ac2.Score(dpoints, labels)
 	rep = ac2.Report
-	exp = 0.9230769
+	exp = 1.0
 	if math.Abs(rep.FScore(1.0)-exp) > 1e-5 {
 		t.Errorf("expected F-score %.7f, got %.7f", exp, rep.FScore(1.0))
 	}
 }
 
+func TestAdaBoostMulticlass(t *testing.T) {
+	dpoints := [][]float64{
+		{1, 1}, {2, 1}, {1, 2}, {2, 2},
+		{8, 1}, {9, 1}, {8, 2}, {9, 2},
+		{5, 8}, {6, 8}, {5, 9}, {6, 9},
+	}
+	labels := []float64{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2}
+
+	ac := NewAdaBoostClassifier(3, ch09.Gini, 0.0)
+	ac.Fit(dpoints, labels)
+	if acc := ac.Score(dpoints, labels); acc != 1.0 {
+		t.Errorf("expected accuracy 1, got %.4f", acc)
+	}
+	if prec := ac.Report.Precision; prec != 1.0 {
+		t.Errorf("expected macro precision 1, got %.4f", prec)
+	}
+}
+
+func TestAdaBoostStaged(t *testing.T) {
+	// The positive class is a band that a single stump cannot separate.
+	dpoints := [][]float64{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}, {9}, {10}}
+	labels := []float64{0, 0, 0, 1, 1, 1, 1, 0, 0, 0}
+
+	for _, algo := range []string{SAMME, SAMMER} {
+		ac := NewAdaBoostClassifier(10, ch09.Gini, 0.0)
+		ac.Algorithm = algo
+		ac.Fit(dpoints, labels)
+		accs := ac.StagedScore(dpoints, labels)
+		if len(accs) != ac.Size || len(ac.Coeffs) != ac.Size {
+			t.Errorf("%s: expected %d stages, got %d", algo, ac.Size, len(accs))
+		}
+		if accs[0] >= 1.0 {
+			t.Errorf("%s: expected a single stump to fail, got accuracy %.2f", algo, accs[0])
+		}
+		if last := accs[len(accs)-1]; last != 1.0 {
+			t.Errorf("%s: expected final accuracy 1, got %.2f", algo, last)
+		}
+		// Reweighting makes the stumps differ.
+		if ac.Size > 1 {
+			first, second := ac.Estimators[0].Root.Split, ac.Estimators[1].Root.Split
+			if first.Dimension == second.Dimension && first.Threshold == second.Threshold {
+				t.Errorf("%s: expected different stumps, got %+v twice", algo, first)
+			}
+		}
+		// Polling the stumps in parallel adds up the same votes.
+		seq := ac.PredictDist(dpoints)
+		ac.NJobs = 4
+		for j, dist := range ac.PredictDist(dpoints) {
+			if dist[0] != seq[j][0] || dist[1] != seq[j][1] {
+				t.Errorf("%s: example %d: expected %v, got %v", algo, j, seq[j], dist)
+			}
+		}
+	}
+	// Boosting stops once a stump fits perfectly.
+	ac := NewAdaBoostClassifier(10, ch09.Gini, 0.0)
+	ac.Fit(dpoints, []float64{0, 0, 0, 0, 0, 1, 1, 1, 1, 1})
+	if ac.Size != 1 || len(ac.Estimators) != 1 {
+		t.Errorf("expected early stop after 1 tree, got %d", ac.Size)
+	}
+}
+
 func TestGradBoostRegressor(t *testing.T) {
 	dpoints := [][]float64{{10}, {20}, {30}, {40}, {50}, {60}, {70}, {80}, {86}}
 	labels := []float64{7, 5, 7, 1, 2, 1, 5, 4, 3.6}
 
 	gb := NewGradBoostRegressor(2, 0.1, 0.8)
-	gb.Fit(dpoints, labels)
+	if err := gb.Fit(dpoints, labels); err != nil {
+		t.Fatal(err)
+	}
 	got := gb.Score(dpoints, labels)
-	exp := 0.9822822
+	// F = mean + 0.8 (tree1 + tree2)
+	exp := 0.9661739
 	if math.Abs(got-exp) > 1e-5 {
 		t.Errorf("expected R2 score %.7f, got %.7f", exp, got)
 	}
@@ -56,3 +127,292 @@ func TestGradBoostRegressor(t *testing.T) {
 		t.Errorf("expected R2 score %.7f, got %.7f", exp, got)
 	}
 }
+
+func TestGradBoostShrinkage(t *testing.T) {
+	dpoints := [][]float64{{10}, {20}, {30}, {40}, {50}, {60}, {70}, {80}, {86}}
+	labels := []float64{7, 5, 7, 1, 2, 1, 5, 4, 3.6}
+
+	gb := NewGradBoostRegressor(3, 0.0, 0.5)
+	gb.Limits.MaxDepth = 2
+	if err := gb.Fit(dpoints, labels); err != nil {
+		t.Fatal(err)
+	}
+	// Predictions add up the initial constant and the shrunk tree predictions.
+	exp := make([]float64, len(dpoints))
+	for i := range exp {
+		exp[i] = gb.Init[0]
+	}
+	for _, trees := range gb.Trees {
+		for i, pred := range trees[0].Predict(dpoints) {
+			exp[i] += 0.5 * pred
+		}
+	}
+	for i, got := range gb.Predict(dpoints) {
+		if math.Abs(got-exp[i]) > 1e-9 {
+			t.Errorf("example %d: expected %.4f, got %.4f", i, exp[i], got)
+		}
+	}
+	// All hyperparameters are persisted.
+	gb.Subsample, gb.ColSample, gb.Seed = 0.7, 1.0, 3
+	if err := gb.Fit(dpoints, labels); err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := gb.Marshal()
+	gb2 := &GradBoostRegressor{}
+	gb2.Unmarshal(bs)
+	if gb2.LRate != 0.5 || gb2.Subsample != 0.7 || gb2.Seed != 3 || gb2.Limits.MaxDepth != 2 {
+		t.Errorf("expected hyperparameters of %+v, got %+v", gb.GradBoost, gb2.GradBoost)
+	}
+	preds, preds2 := gb.Predict(dpoints), gb2.Predict(dpoints)
+	for i := range preds {
+		if preds[i] != preds2[i] {
+			t.Errorf("example %d: expected %.4f, got %.4f", i, preds[i], preds2[i])
+		}
+	}
+}
+
+func TestGradBoostLosses(t *testing.T) {
+	dpoints := [][]float64{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}
+	labels := []float64{1, 2, 1, 2, 10, 12, 10, 40}
+
+	// Without trees, the initial constant is the loss minimiser.
+	cases := []struct {
+		loss  string
+		alpha float64
+		exp   float64
+	}{
+		{SquaredLoss, 0.0, 9.75},
+		{AbsoluteLoss, 0.0, 2.0},
+		{QuantileLoss, 0.75, 10.0},
+		{HuberLoss, 0.9, 2.0},
+		{PoissonLoss, 0.0, 9.75},
+	}
+	for _, c := range cases {
+		gb := NewGradBoostRegressor(0, 0.0, 0.1)
+		gb.Loss, gb.Alpha = c.loss, c.alpha
+		if err := gb.Fit(dpoints, labels); err != nil {
+			t.Fatal(err)
+		}
+		if got := gb.Predict(dpoints[:1])[0]; math.Abs(got-c.exp) > 1e-9 {
+			t.Errorf("%s: expected constant %.4f, got %.4f", c.loss, c.exp, got)
+		}
+	}
+	// Boosting gets closer to the labels than the constant.
+	for _, c := range cases {
+		gb := NewGradBoostRegressor(20, 0.0, 0.3)
+		gb.Loss, gb.Alpha = c.loss, c.alpha
+		gb.Limits.MaxDepth = 2
+		if err := gb.Fit(dpoints, labels); err != nil {
+			t.Fatal(err)
+		}
+		var before, after float64
+		for i, pred := range gb.Predict(dpoints) {
+			before += math.Abs(labels[i] - c.exp)
+			after += math.Abs(labels[i] - pred)
+		}
+		if after >= before {
+			t.Errorf("%s: expected absolute error below %.4f, got %.4f", c.loss, before, after)
+		}
+	}
+}
+
+func TestGradBoostLossValidation(t *testing.T) {
+	dpoints := [][]float64{{1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}}
+	labels := []float64{1, 2, 1, 2, 10, 12, 10, 40}
+
+	// Alpha 0 stands for the default level of the loss.
+	for _, loss := range []string{HuberLoss, QuantileLoss} {
+		def := NewGradBoostRegressor(5, 0.0, 0.3)
+		def.Loss = loss
+		exp := NewGradBoostRegressor(5, 0.0, 0.3)
+		exp.Loss, exp.Alpha = loss, DefaultQuantileAlpha
+		if loss == HuberLoss {
+			exp.Alpha = DefaultHuberAlpha
+		}
+		if err := def.Fit(dpoints, labels); err != nil {
+			t.Fatal(err)
+		}
+		if err := exp.Fit(dpoints, labels); err != nil {
+			t.Fatal(err)
+		}
+		want := exp.Predict(dpoints)
+		for i, got := range def.Predict(dpoints) {
+			if got != want[i] {
+				t.Errorf("%s: expected %.4f with the default alpha, got %.4f", loss, want[i], got)
+			}
+		}
+	}
+	// Unknown losses and levels outside (0, 1) are rejected.
+	for _, c := range []struct {
+		loss  string
+		alpha float64
+	}{{"hinge", 0.0}, {HuberLoss, 1.0}, {QuantileLoss, -0.5}} {
+		gb := NewGradBoostRegressor(5, 0.0, 0.3)
+		gb.Loss, gb.Alpha = c.loss, c.alpha
+		if err := gb.Fit(dpoints, labels); err == nil {
+			t.Errorf("%s with alpha %v: expected an error", c.loss, c.alpha)
+		}
+	}
+	gb := &GradBoostRegressor{}
+	if err := gb.Unmarshal([]byte(`{"loss": "hinge"}`)); err == nil {
+		t.Error("expected an error for an unknown loss")
+	}
+}
+
+func TestGradBoostClassifier(t *testing.T) {
+	dpoints := [][]float64{
+		{1, 1}, {2, 1}, {1, 2}, {2, 2},
+		{8, 1}, {9, 1}, {8, 2}, {9, 2},
+		{5, 8}, {6, 8}, {5, 9}, {6, 9},
+	}
+	binary := []float64{0, 0, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1}
+	multi := []float64{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2}
+
+	for _, labels := range [][]float64{binary, multi} {
+		gc := NewGradBoostClassifier(10, 0.0, 0.5)
+		gc.Limits.MaxDepth = 2
+		gc.ColSample = 0.5
+		gc.Fit(dpoints, labels)
+		if acc := gc.Score(dpoints, labels); acc != 1.0 {
+			t.Errorf("%s: expected accuracy 1, got %.4f", gc.Loss, acc)
+		}
+		for i, dist := range gc.PredictDist(dpoints) {
+			if p := dist[int(labels[i])]; p < 0.5 {
+				t.Errorf("%s: example %d: expected probability above 0.5, got %.4f", gc.Loss, i, p)
+			}
+		}
+	}
+}
+
+func TestSecondOrderBoosting(t *testing.T) {
+	nan := math.NaN()
+	dpoints := [][]float64{
+		{1, 1}, {2, nan}, {1, 2}, {2, 2},
+		{8, 1}, {9, 1}, {nan, 2}, {9, 2},
+		{5, 8}, {6, 8}, {5, nan}, {6, 9},
+	}
+	labels := []float64{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2}
+
+	gc := NewGradBoostClassifier(10, 0.0, 0.5)
+	gc.SecondOrder = true
+	gc.Reg = ch09.Regularisation{Lambda: 1.0, MinChildWeight: 0.1}
+	gc.ColSampleLevel = 0.5
+	gc.Limits.MaxDepth = 3
+	gc.Fit(dpoints, labels)
+	if acc := gc.Score(dpoints, labels); acc != 1.0 {
+		t.Errorf("expected accuracy 1, got %.4f", acc)
+	}
+	// The regularisation is persisted.
+	bs, _ := gc.Marshal()
+	gc2 := &GradBoostClassifier{}
+	gc2.Unmarshal(bs)
+	if gc2.Reg != gc.Reg || !gc2.SecondOrder || gc2.ColSampleLevel != 0.5 {
+		t.Errorf("expected %+v, got %+v", gc.GradBoost, gc2.GradBoost)
+	}
+	preds, preds2 := gc.Predict(dpoints), gc2.Predict(dpoints)
+	for i := range preds {
+		if preds[i] != preds2[i] {
+			t.Errorf("example %d: expected %v, got %v", i, preds[i], preds2[i])
+		}
+	}
+
+	// With the squared loss and unit second derivatives, the regression
+	// trees fit the residuals.
+	rdpoints := [][]float64{{10}, {20}, {30}, {40}, {50}, {60}, {70}, {80}, {86}}
+	rlabels := []float64{7, 5, 7, 1, 2, 1, 5, 4, 3.6}
+	gb := NewGradBoostRegressor(30, 0.0, 0.3)
+	gb.SecondOrder = true
+	gb.Limits.MaxDepth = 2
+	if err := gb.Fit(rdpoints, rlabels); err != nil {
+		t.Fatal(err)
+	}
+	if score := gb.Score(rdpoints, rlabels); score < 0.95 {
+		t.Errorf("expected R2 score above 0.95, got %.4f", score)
+	}
+}
+
+func TestIsolationForest(t *testing.T) {
+	if c := AvgPathLength(2); c != 1.0 {
+		t.Errorf("expected c(2) = 1, got %.4f", c)
+	}
+	// c(256) = 2 (ln 255 + gamma) - 2 * 255/256
+	if c := AvgPathLength(256); math.Abs(c-10.2447) > 1e-4 {
+		t.Errorf("expected c(256) = 10.2447, got %.4f", c)
+	}
+	// A grid of normal data and two far-away anomalies.
+	var dpoints [][]float64
+	for i := 0; i < 98; i++ {
+		dpoints = append(dpoints, []float64{float64(i % 10), float64(i / 10)})
+	}
+	dpoints = append(dpoints, []float64{40, 40}, []float64{-30, 50})
+
+	iso := NewIsolationForest(50, 0.02)
+	iso.SampleSize = 64
+	iso.Fit(dpoints)
+	scores := iso.AnomalyScore(dpoints)
+	for i, score := range scores[:98] {
+		if score >= scores[98] || score >= scores[99] {
+			t.Errorf("example %d: expected a lower score than the anomalies, got %.4f", i, score)
+		}
+	}
+	preds := iso.Predict(dpoints)
+	var anomalies float64
+	for _, pred := range preds {
+		anomalies += pred
+	}
+	if anomalies != 2 || preds[98] != 1 || preds[99] != 1 {
+		t.Errorf("expected the two anomalies to be flagged, got %v", preds)
+	}
+	persist.Dump(iso, "../../models/ch09-tree/isolation.json")
+
+	iso2 := &IsolationForest{}
+	persist.Load(iso2, "../../models/ch09-tree/isolation.json")
+	for i, score := range iso2.AnomalyScore(dpoints[96:]) {
+		if math.Abs(score-scores[96+i]) > 1e-9 {
+			t.Errorf("example %d: expected score %.4f, got %.4f", 96+i, scores[96+i], score)
+		}
+	}
+}
+
+func TestIsolationForestEmpty(t *testing.T) {
+	f := NewIsolationForest(10, 0.1)
+	f.Fit(nil)
+	if len(f.Trees) != 0 {
+		t.Errorf("expected no trees, got %d", len(f.Trees))
+	}
+	for _, score := range f.AnomalyScore([][]float64{{1, 2}}) {
+		if score != 0.5 {
+			t.Errorf("expected score 0.5, got %v", score)
+		}
+	}
+	if pred := f.Predict([][]float64{{1, 2}}); pred[0] != 0.0 {
+		t.Errorf("expected a normal data point, got %v", pred[0])
+	}
+}
+
+func TestFeatureImportances(t *testing.T) {
+	// The label depends on the second component only.
+	var dpoints [][]float64
+	var labels []float64
+	for i := 0; i < 40; i++ {
+		dpoints = append(dpoints, []float64{float64(i % 5), float64(i)})
+		if i%20 >= 10 {
+			labels = append(labels, 1)
+		} else {
+			labels = append(labels, 0)
+		}
+	}
+
+	ac := NewAdaBoostClassifier(10, ch09.Gini, 0.0)
+	ac.Fit(dpoints, labels)
+	gb := NewGradBoostRegressor(20, 0.0, 0.1)
+	gb.ColSample = 0.5
+	if err := gb.Fit(dpoints, labels); err != nil {
+		t.Fatal(err)
+	}
+	for name, imps := range map[string][]float64{"adaboost": ac.FeatureImportances(), "gradboost": gb.FeatureImportances()} {
+		if len(imps) != 2 || imps[1] < 0.5 || math.Abs(imps[0]+imps[1]-1.0) > 1e-9 {
+			t.Errorf("%s: expected the second component to matter most, got %v", name, imps)
+		}
+	}
+}
@@ -2,51 +2,284 @@ package ch12
 
 import (
 	"encoding/json"
+	"math/rand"
+	"sort"
 
 	"grokml/pkg/ch09-tree"
 	pl "grokml/pkg/pipeline"
 )
 
-// GradBoostClassifier implements a forest classifier with Gradient Boost.
+// GradBoost implements the gradient boosting engine shared by
+// GradBoostRegressor and GradBoostClassifier. Starting from the constant
+// raw scores Init, every round fits one regression tree per output to the
+// negative gradient of the loss and adds its predictions, shrunk by the
+// learning rate LRate, to the raw scores. The leaf values are refined to
+// minimise the loss (see Loss). Every round sees the share Subsample of the
+// examples and ColSample of the data point components (1 or 0 for all),
+// drawn with the random seed Seed. The trees are grown with the minimum gain
+// MinGain and the stopping rules Limits.
+//
+// With SecondOrder, the engine boosts XGBoost-style: the trees are grown
+// from the gradients and second derivatives of the loss with the
+// regularisation Reg (see ch09.Regularisation), searching the share
+// ColSampleLevel of the components per level, and their leaves hold
+// Newton steps. Missing components (NaN) are routed along the default
+// directions learned by the splits.
+type GradBoost struct {
+	Size           int                     `json:"size"`
+	Loss           string                  `json:"loss"`
+	Alpha          float64                 `json:"alpha"`
+	LRate          float64                 `json:"lrate"`
+	Subsample      float64                 `json:"subsample"`
+	ColSample      float64                 `json:"colsample"`
+	MinGain        float64                 `json:"min_gain"`
+	Limits         ch09.Limits             `json:"limits"`
+	Seed           int64                   `json:"seed"`
+	SecondOrder    bool                    `json:"second_order"`
+	Reg            ch09.Regularisation     `json:"reg"`
+	ColSampleLevel float64                 `json:"colsample_level"`
+	Init           []float64               `json:"init"`
+	Trees          [][]*ch09.TreeRegressor `json:"trees"`
+	flat           [][]*ch09.FlatTree
+}
+
+// Compile compiles the trees to flat trees, which predict batches of data
+// points faster (see ch09.FlatTree). Training and Unmarshal compile the
+// trees; after changing them, Compile must be called again.
+func (gb *GradBoost) Compile() {
+	gb.flat = make([][]*ch09.FlatTree, len(gb.Trees))
+	for m, trees := range gb.Trees {
+		gb.flat[m] = make([]*ch09.FlatTree, len(trees))
+		for k, tree := range trees {
+			gb.flat[m][k] = tree.Flatten()
+		}
+	}
+}
+
+// predictTree is a helper method that returns the predictions of the tree of
+// output k in round m, compiled unless the trees have not been compiled, eg
+// when the engine was decoded from gob.
+func (gb *GradBoost) predictTree(m, k int, dpoints [][]float64) []float64 {
+	if len(gb.flat) == len(gb.Trees) {
+		return gb.flat[m][k].Predict(dpoints)
+	}
+	return gb.Trees[m][k].Predict(dpoints)
+}
+
+// loss returns the loss of the engine or an error if its name is unknown or
+// its level Alpha invalid.
+func (gb *GradBoost) loss() (Loss, error) {
+	return NewLoss(gb.Loss, gb.Alpha)
+}
+
+// fit implements the boosting rounds for nOut outputs.
+func (gb *GradBoost) fit(loss Loss, dpoints [][]float64, labels []float64, weights []float64, nOut int) {
+	rng := rand.New(rand.NewSource(gb.Seed))
+	gb.Init = loss.Init(labels, weights, nOut)
+	raw := make([][]float64, len(dpoints))
+	for i := range raw {
+		raw[i] = append([]float64(nil), gb.Init...)
+	}
+	gb.Trees = make([][]*ch09.TreeRegressor, gb.Size)
+	for m := range gb.Trees {
+		rows := sample(rng, len(dpoints), gb.Subsample)
+		cols := sample(rng, len(dpoints[0]), gb.ColSample)
+		sub := make([][]float64, len(rows))
+		subWeights := make([]float64, len(rows))
+		for j, i := range rows {
+			sub[j] = project(dpoints[i], cols)
+			subWeights[j] = weights[i]
+		}
+		gb.Trees[m] = make([]*ch09.TreeRegressor, nOut)
+		for k := range gb.Trees[m] {
+			grad := loss.Gradient(labels, raw, k)
+			subGrad := make([]float64, len(rows))
+			for j, i := range rows {
+				subGrad[j] = grad[i]
+			}
+			tree := ch09.NewTreeRegressor(gb.MinGain)
+			tree.Limits = gb.Limits
+			if gb.SecondOrder {
+				hess := loss.Hessian(labels, raw, k)
+				subHess := make([]float64, len(rows))
+				for j, i := range rows {
+					subGrad[j] = -subGrad[j] // the gradient, not its negative
+					subHess[j] = hess[i]
+				}
+				tree.ColSampleLevel = gb.ColSampleLevel
+				tree.FitNewton(sub, subGrad, subHess, subWeights, gb.Reg, rng)
+			} else {
+				tree.FitWeighted(sub, subGrad, subWeights)
+				// refine the leaf values with the examples reaching them
+				reached := map[*ch09.Node][]int{}
+				for j, leaf := range tree.Apply(sub) {
+					reached[leaf] = append(reached[leaf], rows[j])
+				}
+				for leaf, idx := range reached {
+					leaf.Label = loss.Leaf(labels, raw, weights, idx, k)
+				}
+			}
+			remap(tree.Root, cols)
+			tree.Importances = spread(tree.Importances, cols, len(dpoints[0]))
+			gb.Trees[m][k] = &tree
+		}
+		// all outputs' gradients refer to the raw scores of the last round
+		for k, tree := range gb.Trees[m] {
+			for i, pred := range tree.Predict(dpoints) {
+				raw[i][k] += gb.LRate * pred
+			}
+		}
+	}
+	gb.Compile()
+}
+
+// raw computes the raw scores of the data points: the initial constants plus
+// the shrunk predictions of all (compiled) trees.
+func (gb *GradBoost) raw(dpoints [][]float64) [][]float64 {
+	raw := make([][]float64, len(dpoints))
+	for i := range raw {
+		raw[i] = append([]float64(nil), gb.Init...)
+	}
+	for m, trees := range gb.Trees {
+		for k := range trees {
+			for i, pred := range gb.predictTree(m, k, dpoints) {
+				raw[i][k] += gb.LRate * pred
+			}
+		}
+	}
+	return raw
+}
+
+// transform computes the predictions of the data points, ie their raw scores
+// transformed by the loss.
+func (gb *GradBoost) transform(dpoints [][]float64) [][]float64 {
+	loss, err := gb.loss()
+	if err != nil { // Fit and Unmarshal reject such losses
+		panic(err)
+	}
+	preds := gb.raw(dpoints)
+	for i, raw := range preds {
+		preds[i] = loss.Transform(raw)
+	}
+	return preds
+}
+
+// Marshal and Unmarshal implement the JSONable interface (pkg: persist).
+func (gb GradBoost) Marshal() ([]byte, error) {
+	return json.MarshalIndent(gb, "", "    ")
+}
+
+func (gb *GradBoost) Unmarshal(bs []byte) error {
+	if err := json.Unmarshal(bs, gb); err != nil {
+		return err
+	}
+	if _, err := gb.loss(); err != nil {
+		return err
+	}
+	gb.Compile()
+	return nil
+}
+
+// sample is a helper function that draws the sorted indices of the share
+// frac of n items without replacement. A share of 0 or 1 draws all of them.
+func sample(rng *rand.Rand, n int, frac float64) []int {
+	size := int(frac * float64(n))
+	if frac <= 0.0 || frac >= 1.0 || size < 1 {
+		size = n
+	}
+	var idx []int
+	if size == n {
+		idx = make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx
+	}
+	idx = rng.Perm(n)[:size]
+	sort.Ints(idx)
+	return idx
+}
+
+// project is a helper function that picks the given components of a data point.
+func project(dpoint []float64, cols []int) []float64 {
+	proj := make([]float64, len(cols))
+	for j, col := range cols {
+		proj[j] = dpoint[col]
+	}
+	return proj
+}
+
+// remap is a helper function that translates the split dimensions of a tree
+// trained on projected data points back to the original components.
+func remap(nd *ch09.Node, cols []int) {
+	if nd == nil || nd.Left == nil {
+		return
+	}
+	nd.Split.Dimension = cols[nd.Split.Dimension]
+	remap(nd.Left, cols)
+	remap(nd.Right, cols)
+}
+
+// spread is a helper function that translates the importances of a tree
+// trained on projected data points back to the nDims original components.
+func spread(importances []float64, cols []int, nDims int) []float64 {
+	spread := make([]float64, nDims)
+	for j, imp := range importances {
+		spread[cols[j]] = imp
+	}
+	return spread
+}
+
+// FeatureImportances averages the normalised importances of all trees.
+func (gb *GradBoost) FeatureImportances() []float64 {
+	var importances [][]float64
+	for _, trees := range gb.Trees {
+		for _, tree := range trees {
+			importances = append(importances, tree.Importances)
+		}
+	}
+	return ch09.AverageImportances(importances, nil)
+}
+
+// GradBoostRegressor implements gradient boosting for regression, by default
+// with the squared loss. Other losses are AbsoluteLoss, HuberLoss,
+// QuantileLoss and PoissonLoss; Alpha sets the level of the Huber and
+// quantile losses, 0 their default (see NewLoss).
 type GradBoostRegressor struct {
-	Size       int                   `json:"size"`
-	Regressors []*ch09.TreeRegressor `json:"trees"`
-	lRate      float64               `json:"-"`
+	GradBoost
 }
 
-// NewGradBoostClassifier is the constructor function for GradBoostClassifier.
-// Parameters are the same as for NewForestClassifier.
+// NewGradBoostRegressor is the constructor function for GradBoostRegressor.
+// Its parameters are the number of trees, the minimum gain and the learning rate.
 func NewGradBoostRegressor(nTrees int, ming float64, lrate float64) *GradBoostRegressor {
-	trees := make([]*ch09.TreeRegressor, nTrees)
-	for i, _ := range trees {
-		reg := ch09.NewTreeRegressor(ming)
-		trees[i] = &reg
-	}
-	return &GradBoostRegressor{Size: nTrees, Regressors: trees, lRate: lrate}
-}
-
-// Fit implements the training of the gradient boosting algorithm for a forest of
-// tree classifiers. Except for the first tree each tree is trained on the error of
-// its predecessor so that the sum of their predcitions is a better prediction.
-func (gb *GradBoostRegressor) Fit(dpoints [][]float64, labels []float64) {
-	clabels := make([]float64, len(labels))
-	copy(clabels, labels)
-	for _, tree := range gb.Regressors {
-		tree.Fit(dpoints, clabels)
-		for j, pred := range tree.Predict(dpoints) {
-			clabels[j] -= pred
-		}
+	return &GradBoostRegressor{GradBoost{Size: nTrees, Loss: SquaredLoss, LRate: lrate, MinGain: ming}}
+}
+
+// Fit implements the training of the gradient boosting algorithm for a forest
+// of regression trees. Starting from a constant, each tree is trained on the
+// negative gradient of the loss, ie on the errors of its predecessors for the
+// squared loss, so that the sum of their shrunk predictions is a better prediction.
+// It fails if the loss is unknown or its level Alpha invalid.
+func (gb *GradBoostRegressor) Fit(dpoints [][]float64, labels []float64) error {
+	return gb.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted implements the training with sample weights.
+func (gb *GradBoostRegressor) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) error {
+	loss, err := gb.loss()
+	if err != nil {
+		return err
 	}
+	gb.fit(loss, dpoints, labels, weights, 1)
+	return nil
 }
 
-// Predict performs the inference for the given data points by computing a linear
-// combination of their predictions.
+// Predict performs the inference for the given data points by adding up the
+// initial constant and the predictions of the trees shrunk by the learning rate.
 func (gb *GradBoostRegressor) Predict(dpoints [][]float64) []float64 {
-	preds := gb.Regressors[0].Predict(dpoints)
-	for _, tree := range gb.Regressors[1:] {
-		for i, pred := range tree.Predict(dpoints) {
-			preds[i] += gb.lRate * pred
-		}
+	preds := make([]float64, len(dpoints))
+	for i, pred := range gb.transform(dpoints) {
+		preds[i] = pred[0]
 	}
 	return preds
 }
@@ -57,11 +290,101 @@ func (gb *GradBoostRegressor) Score(dpoints [][]float64, labels []float64) float
 	return pl.GetCoD(preds, labels)
 }
 
+// GradBoostClassifier implements gradient boosting for classification with
+// the binary log-loss for two classes and the softmax loss for more.
+type GradBoostClassifier struct {
+	GradBoost
+	Classes int       `json:"classes"`
+	Report  pl.Report `json:"-"`
+}
+
+// NewGradBoostClassifier is the constructor function for GradBoostClassifier.
+// Its parameters are the number of trees, the minimum gain and the learning rate.
+func NewGradBoostClassifier(nTrees int, ming float64, lrate float64) *GradBoostClassifier {
+	return &GradBoostClassifier{GradBoost: GradBoost{Size: nTrees, LRate: lrate, MinGain: ming}}
+}
+
+// Fit implements the training on labels that are the class indices.
+func (gc *GradBoostClassifier) Fit(dpoints [][]float64, labels []float64) {
+	gc.FitWeighted(dpoints, labels, pl.UnitWeights(len(dpoints)))
+}
+
+// FitWeighted implements the training with sample weights. The loss is chosen
+// by the number of classes: LogLoss with a single output for two classes,
+// SoftmaxLoss with one output per class for more.
+func (gc *GradBoostClassifier) FitWeighted(dpoints [][]float64, labels []float64, weights []float64) {
+	gc.Classes = ch09.NumClasses(labels)
+	classes := make([]float64, len(labels))
+	for i, label := range labels {
+		classes[i] = float64(ch09.Class(label, gc.Classes))
+	}
+	if gc.Classes > 2 {
+		gc.Loss = SoftmaxLoss
+		gc.fit(softmax{}, dpoints, classes, weights, gc.Classes)
+	} else {
+		gc.Loss = LogLoss
+		gc.fit(logLoss{}, dpoints, classes, weights, 1)
+	}
+}
+
+// PredictDist returns the class distributions of the data points.
+func (gc *GradBoostClassifier) PredictDist(dpoints [][]float64) [][]float64 {
+	dists := gc.transform(dpoints)
+	if gc.Classes <= 2 {
+		for i, dist := range dists {
+			dists[i] = []float64{1.0 - dist[0], dist[0]}
+		}
+	}
+	return dists
+}
+
+// PredictProba returns the probabilities of the positive class (class 1).
+func (gc *GradBoostClassifier) PredictProba(dpoints [][]float64) []float64 {
+	probs := make([]float64, len(dpoints))
+	for i, dist := range gc.PredictDist(dpoints) {
+		probs[i] = dist[1]
+	}
+	return probs
+}
+
+// PredictClass labels the data points whose probability exceeds the threshold with 1.
+func (gc *GradBoostClassifier) PredictClass(dpoints [][]float64, threshold float64) []float64 {
+	return pl.Classify(gc.PredictProba(dpoints), threshold)
+}
+
+// Predict labels the data points with their most probable class.
+func (gc *GradBoostClassifier) Predict(dpoints [][]float64) []float64 {
+	preds := make([]float64, len(dpoints))
+	for i, dist := range gc.PredictDist(dpoints) {
+		preds[i] = float64(ch09.Argmax(dist))
+	}
+	return preds
+}
+
+// Score implements the Estimator interface and additionally computes the
+// quantities of a Report struct.
+func (gc *GradBoostClassifier) Score(dpoints [][]float64, labels []float64) float64 {
+	predictions := gc.Predict(dpoints)
+	if gc.Classes > 2 {
+		gc.Report = pl.GetMultiReport(predictions, labels)
+	} else {
+		gc.Report = pl.GetReport(predictions, labels)
+	}
+	return gc.Report.Accuracy
+}
+
 // Marshal and Unmarshal implement the JSONable interface (pkg: persist).
-func (gb GradBoostRegressor) Marshal() ([]byte, error) {
-	return json.MarshalIndent(gb, "", "    ")
+func (gc GradBoostClassifier) Marshal() ([]byte, error) {
+	return json.MarshalIndent(gc, "", "    ")
 }
 
-func (gb *GradBoostRegressor) Unmarshal(bs []byte) error {
-	return json.Unmarshal(bs, gb)
+func (gc *GradBoostClassifier) Unmarshal(bs []byte) error {
+	if err := json.Unmarshal(bs, gc); err != nil {
+		return err
+	}
+	if _, err := gc.loss(); err != nil {
+		return err
+	}
+	gc.Compile()
+	return nil
 }
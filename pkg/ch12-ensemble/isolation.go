@@ -0,0 +1,208 @@
+package ch12
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+
+	"grokml/pkg/ch09-tree"
+	pl "grokml/pkg/pipeline"
+)
+
+// eulerGamma is the Euler-Mascheroni constant.
+const eulerGamma = 0.5772156649015329
+
+// IsolationForest implements the Isolation Forest anomaly detector. Its trees
+// isolate the examples of random subsamples of size SampleSize (256 if 0) by
+// random splits: a random dimension, split at a random threshold between
+// its least and greatest component, until every example is isolated or the
+// depth reaches log2 of the subsample size. Anomalies are few and different,
+// so they are isolated closer to the root. The anomaly score of a data
+// point is
+//
+//	s = 2^(-E[h] / c(n)),
+//
+// where E[h] is its mean path length over the trees and c(n) the mean path
+// length of an unsuccessful search in a binary search tree of n examples.
+// Scores close to 1 indicate anomalies, scores well below 0.5 normal data.
+// Threshold separates anomalies from normal data: it is the score exceeded
+// by the share Contamination of the training examples, or 0.5 if
+// Contamination is 0. The forest is reproducible with the random seed Seed
+// and trained and polled with NJobs goroutines (see pipeline.Parallel).
+type IsolationForest struct {
+	Size          int          `json:"size"`
+	SampleSize    int          `json:"sample_size"`
+	Contamination float64      `json:"contamination"`
+	Seed          int64        `json:"seed"`
+	NJobs         int          `json:"n_jobs,omitempty"`
+	Threshold     float64      `json:"threshold"`
+	Samples       int          `json:"samples"`
+	Trees         []*ch09.Tree `json:"trees"`
+}
+
+// NewIsolationForest is the constructor function for IsolationForest.
+// Its parameters are the number of trees and the contamination.
+func NewIsolationForest(nTrees int, contamination float64) *IsolationForest {
+	return &IsolationForest{Size: nTrees, SampleSize: 256, Contamination: contamination}
+}
+
+// Fit implements the training of the isolation trees. It needs no labels.
+// Afterwards, the threshold is set from the anomaly scores of the data points.
+// Without data points, the forest has no trees (see AnomalyScore).
+func (f *IsolationForest) Fit(dpoints [][]float64) {
+	if len(dpoints) == 0 {
+		f.Samples, f.Trees, f.Threshold = 0, nil, 0.5
+		return
+	}
+	f.Samples = f.SampleSize
+	if f.Samples <= 0 {
+		f.Samples = 256
+	}
+	if f.Samples > len(dpoints) {
+		f.Samples = len(dpoints)
+	}
+	maxDepth := int(math.Ceil(math.Log2(float64(f.Samples))))
+	rng := rand.New(rand.NewSource(f.Seed))
+	seeds := make([]int64, f.Size)
+	for t := range seeds {
+		seeds[t] = rng.Int63()
+	}
+	f.Trees = make([]*ch09.Tree, f.Size)
+	pl.Parallel(f.NJobs, f.Size, func(t int) {
+		treeRng := rand.New(rand.NewSource(seeds[t]))
+		sub := make([][]float64, f.Samples)
+		for j, i := range treeRng.Perm(len(dpoints))[:f.Samples] {
+			sub[j] = dpoints[i]
+		}
+		f.Trees[t] = &ch09.Tree{Root: isolate(treeRng, sub, 0, maxDepth)}
+	})
+	f.Threshold = 0.5
+	if f.Contamination > 0.0 {
+		scores := f.AnomalyScore(dpoints)
+		sort.Float64s(scores)
+		nAnomalies := int(math.Round(f.Contamination * float64(len(scores))))
+		if nAnomalies > len(scores)-1 {
+			nAnomalies = len(scores) - 1
+		}
+		f.Threshold = scores[len(scores)-1-nAnomalies]
+	}
+}
+
+// isolate is a helper function that grows an isolation tree for the data
+// points from a node of the given depth. Missing components (NaN) go right.
+func isolate(rng *rand.Rand, dpoints [][]float64, depth, maxDepth int) *ch09.Node {
+	nd := ch09.NewNode(depth, 0.0)
+	nd.Samples = len(dpoints)
+	if depth >= maxDepth || len(dpoints) <= 1 {
+		return nd
+	}
+	// only dimensions with distinct components can be split
+	var dims []int
+	var los, his []float64
+	for d := range dpoints[0] {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, dpoint := range dpoints {
+			if !math.IsNaN(dpoint[d]) {
+				lo = math.Min(lo, dpoint[d])
+				hi = math.Max(hi, dpoint[d])
+			}
+		}
+		if lo < hi {
+			dims = append(dims, d)
+			los, his = append(los, lo), append(his, hi)
+		}
+	}
+	if len(dims) == 0 {
+		return nd
+	}
+	k := rng.Intn(len(dims))
+	threshold := los[k] + rng.Float64()*(his[k]-los[k])
+	if threshold == los[k] { // leave at least one data point on the left
+		threshold = (los[k] + his[k]) / 2.0
+	}
+	nd.Split = ch09.SplitInfo{Dimension: dims[k], Threshold: threshold}
+	var left, right [][]float64
+	for _, dpoint := range dpoints {
+		if dpoint[dims[k]] < threshold {
+			left = append(left, dpoint)
+		} else {
+			right = append(right, dpoint)
+		}
+	}
+	nd.Left = isolate(rng, left, depth+1, maxDepth)
+	nd.Right = isolate(rng, right, depth+1, maxDepth)
+	return nd
+}
+
+// AvgPathLength computes c(n), the mean path length of an unsuccessful search
+// in a binary search tree of n examples, with which path lengths are
+// normalised. A leaf that holds n examples adds c(n) to the path length
+// as an estimate of the depth of the subtree that would isolate them.
+func AvgPathLength(n int) float64 {
+	switch {
+	case n <= 1:
+		return 0.0
+	case n == 2:
+		return 1.0
+	}
+	size := float64(n)
+	harmonic := math.Log(size-1.0) + eulerGamma
+	return 2.0*harmonic - 2.0*(size-1.0)/size
+}
+
+// PathLength computes the mean path length of the data points over the trees.
+func (f *IsolationForest) PathLength(dpoints [][]float64) []float64 {
+	treeLengths := make([][]float64, len(f.Trees))
+	pl.Parallel(f.NJobs, len(f.Trees), func(t int) {
+		lengths := make([]float64, len(dpoints))
+		for i, leaf := range f.Trees[t].Apply(dpoints) {
+			lengths[i] = float64(leaf.Depth) + AvgPathLength(leaf.Samples)
+		}
+		treeLengths[t] = lengths
+	})
+	avg := make([]float64, len(dpoints))
+	for _, lengths := range treeLengths {
+		for i, length := range lengths {
+			avg[i] += length
+		}
+	}
+	if len(f.Trees) == 0 {
+		return avg
+	}
+	for i := range avg {
+		avg[i] /= float64(len(f.Trees))
+	}
+	return avg
+}
+
+// AnomalyScore computes the anomaly scores of the data points. A forest
+// trained on fewer than two examples cannot tell anomalies from normal data
+// and scores every data point 0.5.
+func (f *IsolationForest) AnomalyScore(dpoints [][]float64) []float64 {
+	norm := AvgPathLength(f.Samples)
+	scores := f.PathLength(dpoints)
+	for i, length := range scores {
+		if norm == 0.0 {
+			scores[i] = 0.5
+			continue
+		}
+		scores[i] = math.Pow(2.0, -length/norm)
+	}
+	return scores
+}
+
+// Predict labels the data points whose anomaly score exceeds the threshold
+// with 1 (anomaly) and the others with 0.
+func (f *IsolationForest) Predict(dpoints [][]float64) []float64 {
+	return pl.Classify(f.AnomalyScore(dpoints), f.Threshold)
+}
+
+// Marshal and Unmarshal implement the JSONable interface (pkg: persist).
+func (f IsolationForest) Marshal() ([]byte, error) {
+	return json.MarshalIndent(f, "", "    ")
+}
+
+func (f *IsolationForest) Unmarshal(bs []byte) error {
+	return json.Unmarshal(bs, f)
+}
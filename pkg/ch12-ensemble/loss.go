@@ -0,0 +1,428 @@
+package ch12
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Names of the losses of GradBoost.
+const (
+	SquaredLoss  = "squared"
+	AbsoluteLoss = "absolute"
+	HuberLoss    = "huber"
+	QuantileLoss = "quantile"
+	LogLoss      = "logloss"
+	SoftmaxLoss  = "softmax"
+	PoissonLoss  = "poisson"
+)
+
+// Loss is the interface of the loss functions that GradBoost minimises. The
+// model's raw scores F hold one value per example and output: a single
+// output for regression and binary classification, one per class for the
+// softmax loss.
+//
+//   - Init computes the constant raw scores the boosting starts from.
+//   - Gradient computes the negative gradient of the loss with respect to
+//     the k-th output, ie the pseudo-residuals the next tree is fitted to.
+//   - Hessian computes the second derivative of the loss with respect to
+//     the k-th output for second-order boosting. The losses based on
+//     absolute values use the constant 1 instead.
+//   - Leaf computes the value of a leaf reached by the examples of the given
+//     indices, ie the step that minimises the loss (exactly or by a Newton step).
+//   - Transform turns the raw scores of an example into predictions.
+type Loss interface {
+	Init(labels []float64, weights []float64, nOut int) []float64
+	Gradient(labels []float64, raw [][]float64, k int) []float64
+	Hessian(labels []float64, raw [][]float64, k int) []float64
+	Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64
+	Transform(raw []float64) []float64
+}
+
+// Default levels alpha of the Huber and quantile losses.
+const (
+	DefaultHuberAlpha    = 0.9
+	DefaultQuantileAlpha = 0.5
+)
+
+// NewLoss returns the loss of the given name. alpha is the quantile level
+// of the quantile loss and the quantile of the absolute residuals the Huber
+// loss switches from squared to absolute at. It must lie between 0 and 1;
+// 0 stands for the default level of the loss.
+func NewLoss(name string, alpha float64) (Loss, error) {
+	if name == HuberLoss || name == QuantileLoss {
+		if alpha < 0.0 || alpha >= 1.0 {
+			return nil, fmt.Errorf("alpha %v of %s loss not in (0, 1)", alpha, name)
+		}
+		if alpha == 0.0 && name == HuberLoss {
+			alpha = DefaultHuberAlpha
+		} else if alpha == 0.0 {
+			alpha = DefaultQuantileAlpha
+		}
+	}
+	switch name {
+	case SquaredLoss, "":
+		return squared{}, nil
+	case AbsoluteLoss:
+		return quantile{alpha: 0.5}, nil
+	case HuberLoss:
+		return &huber{alpha: alpha}, nil
+	case QuantileLoss:
+		return quantile{alpha: alpha}, nil
+	case LogLoss:
+		return logLoss{}, nil
+	case SoftmaxLoss:
+		return softmax{}, nil
+	case PoissonLoss:
+		return poisson{}, nil
+	}
+	return nil, fmt.Errorf("unknown loss %q", name)
+}
+
+// squared implements the squared loss (y - F)^2 / 2.
+type squared struct{}
+
+func (squared) Init(labels []float64, weights []float64, nOut int) []float64 {
+	return []float64{weightedMean(labels, weights, nil)}
+}
+
+func (squared) Gradient(labels []float64, raw [][]float64, k int) []float64 {
+	return residuals(labels, raw)
+}
+
+func (squared) Hessian(labels []float64, raw [][]float64, k int) []float64 {
+	return ones(len(labels))
+}
+
+func (squared) Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64 {
+	return weightedMean(residuals(labels, raw), weights, idx)
+}
+
+func (squared) Transform(raw []float64) []float64 { return raw }
+
+// quantile implements the pinball loss of the alpha-quantile, which is the
+// absolute loss |y - F| (up to a factor) for alpha 0.5.
+type quantile struct {
+	alpha float64
+}
+
+func (q quantile) Init(labels []float64, weights []float64, nOut int) []float64 {
+	return []float64{weightedQuantile(labels, weights, nil, q.alpha)}
+}
+
+func (q quantile) Gradient(labels []float64, raw [][]float64, k int) []float64 {
+	grad := make([]float64, len(labels))
+	for i, label := range labels {
+		if label > raw[i][0] {
+			grad[i] = q.alpha
+		} else {
+			grad[i] = q.alpha - 1.0
+		}
+	}
+	return grad
+}
+
+func (quantile) Hessian(labels []float64, raw [][]float64, k int) []float64 {
+	return ones(len(labels))
+}
+
+func (q quantile) Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64 {
+	return weightedQuantile(residuals(labels, raw), weights, idx, q.alpha)
+}
+
+func (quantile) Transform(raw []float64) []float64 { return raw }
+
+// huber implements the Huber loss, which is squared for residuals up to delta
+// and absolute beyond. delta is recomputed every round as the alpha-quantile
+// of the absolute residuals.
+type huber struct {
+	alpha float64
+	delta float64
+}
+
+func (h *huber) Init(labels []float64, weights []float64, nOut int) []float64 {
+	return []float64{weightedQuantile(labels, weights, nil, 0.5)}
+}
+
+func (h *huber) Gradient(labels []float64, raw [][]float64, k int) []float64 {
+	res := residuals(labels, raw)
+	abs := make([]float64, len(res))
+	for i, r := range res {
+		abs[i] = math.Abs(r)
+	}
+	h.delta = weightedQuantile(abs, nil, nil, h.alpha)
+	for i, r := range res {
+		if abs[i] > h.delta {
+			res[i] = h.delta * sign(r)
+		}
+	}
+	return res
+}
+
+func (*huber) Hessian(labels []float64, raw [][]float64, k int) []float64 {
+	return ones(len(labels))
+}
+
+// Leaf takes the median of the residuals plus the mean of their clipped
+// deviations from it (Friedman's one-step approximation).
+func (h *huber) Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64 {
+	res := residuals(labels, raw)
+	median := weightedQuantile(res, weights, idx, 0.5)
+	dev := make([]float64, len(res))
+	for _, i := range idx {
+		d := res[i] - median
+		dev[i] = sign(d) * math.Min(h.delta, math.Abs(d))
+	}
+	return median + weightedMean(dev, weights, idx)
+}
+
+func (*huber) Transform(raw []float64) []float64 { return raw }
+
+// logLoss implements the binary cross-entropy. The raw score is the log-odds
+// of the positive class.
+type logLoss struct{}
+
+func (logLoss) Init(labels []float64, weights []float64, nOut int) []float64 {
+	p := math.Min(math.Max(weightedMean(labels, weights, nil), eps), 1.0-eps)
+	return []float64{math.Log(p / (1.0 - p))}
+}
+
+func (logLoss) Gradient(labels []float64, raw [][]float64, k int) []float64 {
+	grad := make([]float64, len(labels))
+	for i, label := range labels {
+		grad[i] = label - sigmoid(raw[i][0])
+	}
+	return grad
+}
+
+func (logLoss) Hessian(labels []float64, raw [][]float64, k int) []float64 {
+	hess := make([]float64, len(labels))
+	for i := range labels {
+		p := sigmoid(raw[i][0])
+		hess[i] = p * (1.0 - p)
+	}
+	return hess
+}
+
+// Leaf takes a Newton step: the sum of the residuals over the sum of the
+// second derivatives p(1-p).
+func (logLoss) Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64 {
+	var num, den float64
+	for _, i := range idx {
+		p := sigmoid(raw[i][0])
+		num += weights[i] * (labels[i] - p)
+		den += weights[i] * p * (1.0 - p)
+	}
+	return newton(num, den)
+}
+
+func (logLoss) Transform(raw []float64) []float64 {
+	return []float64{sigmoid(raw[0])}
+}
+
+// softmax implements the multiclass cross-entropy of the softmax of the raw
+// scores, one per class. Labels are the class indices.
+type softmax struct{}
+
+func (softmax) Init(labels []float64, weights []float64, nOut int) []float64 {
+	prior := make([]float64, nOut)
+	var total float64
+	for i, label := range labels {
+		prior[int(label)] += weights[i]
+		total += weights[i]
+	}
+	for k, w := range prior {
+		prior[k] = math.Log(math.Max(w/total, eps))
+	}
+	return prior
+}
+
+func (softmax) Gradient(labels []float64, raw [][]float64, k int) []float64 {
+	grad := make([]float64, len(labels))
+	for i, label := range labels {
+		grad[i] = indicator(int(label) == k) - softmaxOf(raw[i])[k]
+	}
+	return grad
+}
+
+func (softmax) Hessian(labels []float64, raw [][]float64, k int) []float64 {
+	hess := make([]float64, len(labels))
+	for i := range labels {
+		p := softmaxOf(raw[i])[k]
+		hess[i] = p * (1.0 - p)
+	}
+	return hess
+}
+
+// Leaf takes the Newton step of Friedman's multiclass gradient boosting,
+// (K-1)/K times the sum of the residuals over the sum of p(1-p).
+func (softmax) Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64 {
+	var num, den float64
+	for _, i := range idx {
+		p := softmaxOf(raw[i])[k]
+		num += weights[i] * (indicator(int(labels[i]) == k) - p)
+		den += weights[i] * p * (1.0 - p)
+	}
+	nClasses := float64(len(raw[0]))
+	return (nClasses - 1.0) / nClasses * newton(num, den)
+}
+
+func (softmax) Transform(raw []float64) []float64 {
+	return softmaxOf(raw)
+}
+
+// poisson implements the Poisson deviance for count data. The raw score is
+// the logarithm of the expected count.
+type poisson struct{}
+
+func (poisson) Init(labels []float64, weights []float64, nOut int) []float64 {
+	return []float64{math.Log(math.Max(weightedMean(labels, weights, nil), eps))}
+}
+
+func (poisson) Gradient(labels []float64, raw [][]float64, k int) []float64 {
+	grad := make([]float64, len(labels))
+	for i, label := range labels {
+		grad[i] = label - math.Exp(raw[i][0])
+	}
+	return grad
+}
+
+func (poisson) Hessian(labels []float64, raw [][]float64, k int) []float64 {
+	hess := make([]float64, len(labels))
+	for i := range labels {
+		hess[i] = math.Exp(raw[i][0])
+	}
+	return hess
+}
+
+// Leaf takes a Newton step: the sum of the residuals over the sum of the
+// expected counts.
+func (poisson) Leaf(labels []float64, raw [][]float64, weights []float64, idx []int, k int) float64 {
+	var num, den float64
+	for _, i := range idx {
+		mu := math.Exp(raw[i][0])
+		num += weights[i] * (labels[i] - mu)
+		den += weights[i] * mu
+	}
+	return newton(num, den)
+}
+
+func (poisson) Transform(raw []float64) []float64 {
+	return []float64{math.Exp(raw[0])}
+}
+
+// residuals is a helper function computing the differences between the labels
+// and the (single) raw scores.
+func residuals(labels []float64, raw [][]float64) []float64 {
+	res := make([]float64, len(labels))
+	for i, label := range labels {
+		res[i] = label - raw[i][0]
+	}
+	return res
+}
+
+// weightedMean is a helper function computing the weighted mean of the
+// values of the given indices (all values if idx is nil).
+func weightedMean(vals []float64, weights []float64, idx []int) float64 {
+	var sum, total float64
+	each(len(vals), idx, func(i int) {
+		sum += weights[i] * vals[i]
+		total += weights[i]
+	})
+	return sum / total
+}
+
+// weightedQuantile is a helper function computing the alpha-quantile of the
+// values of the given indices (all values if idx is nil), ie the smallest
+// value such that the weights of the values up to it make up the share alpha.
+// Nil weights count as unit weights.
+func weightedQuantile(vals []float64, weights []float64, idx []int, alpha float64) float64 {
+	var order []int
+	each(len(vals), idx, func(i int) { order = append(order, i) })
+	sort.Slice(order, func(a, b int) bool { return vals[order[a]] < vals[order[b]] })
+	weight := func(i int) float64 {
+		if weights == nil {
+			return 1.0
+		}
+		return weights[i]
+	}
+	var total float64
+	for _, i := range order {
+		total += weight(i)
+	}
+	var cum float64
+	for _, i := range order {
+		cum += weight(i)
+		if cum >= alpha*total {
+			return vals[i]
+		}
+	}
+	return vals[order[len(order)-1]]
+}
+
+// each is a helper function that calls fn for the given indices, or for
+// 0, 1, ..., n-1 if idx is nil.
+func each(n int, idx []int, fn func(i int)) {
+	if idx == nil {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	for _, i := range idx {
+		fn(i)
+	}
+}
+
+// newton is a helper function that computes a Newton step and guards
+// against vanishing second derivatives.
+func newton(num, den float64) float64 {
+	if math.Abs(den) < 1e-150 {
+		return 0.0
+	}
+	return num / den
+}
+
+// softmaxOf is a helper function that computes the softmax of the raw scores.
+func softmaxOf(raw []float64) []float64 {
+	max := raw[0]
+	for _, val := range raw {
+		max = math.Max(max, val)
+	}
+	probs := make([]float64, len(raw))
+	var sum float64
+	for k, val := range raw {
+		probs[k] = math.Exp(val - max)
+		sum += probs[k]
+	}
+	for k := range probs {
+		probs[k] /= sum
+	}
+	return probs
+}
+
+func ones(n int) []float64 {
+	vals := make([]float64, n)
+	for i := range vals {
+		vals[i] = 1.0
+	}
+	return vals
+}
+
+func sigmoid(val float64) float64 {
+	return 1.0 / (1.0 + math.Exp(-val))
+}
+
+func sign(val float64) float64 {
+	if val < 0.0 {
+		return -1.0
+	}
+	return 1.0
+}
+
+func indicator(b bool) float64 {
+	if b {
+		return 1.0
+	}
+	return 0.0
+}
@@ -0,0 +1,74 @@
+package codegen
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Check compiles the model to Go, runs the generated code on the data points
+// with the go tool and reports an error unless it reproduces the model's
+// predictions bit for bit.
+func Check(model Predictor, dpoints [][]float64) error {
+	src, err := Generate(model, "main", "predict")
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "codegen")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"go.mod":     "module check\n\ngo 1.20\n",
+		"predict.go": string(src),
+		"main.go":    harness(dpoints),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot run generated code: %v\n%s", err, out)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != len(dpoints) {
+		return fmt.Errorf("expected %d predictions, got %d", len(dpoints), len(lines))
+	}
+	for i, want := range model.Predict(dpoints) {
+		bits, err := strconv.ParseUint(lines[i], 10, 64)
+		if err != nil {
+			return err
+		}
+		if got := math.Float64frombits(bits); got != want && !(math.IsNaN(got) && math.IsNaN(want)) {
+			return fmt.Errorf("data point %d: expected prediction %v, got %v", i, want, got)
+		}
+	}
+	return nil
+}
+
+// harness is a helper function that returns the source code of a program
+// printing the bits of the predictions of the data points.
+func harness(dpoints [][]float64) string {
+	var sb strings.Builder
+	sb.WriteString("package main\n\nimport (\n\t\"fmt\"\n\t\"math\"\n)\n\n")
+	sb.WriteString("var dpoints = [][]float64{\n")
+	for _, dpoint := range dpoints {
+		vals := make([]string, len(dpoint))
+		for j, val := range dpoint {
+			vals[j] = lit(val)
+		}
+		fmt.Fprintf(&sb, "\t{%s},\n", strings.Join(vals, ", "))
+	}
+	sb.WriteString("}\n\nfunc main() {\n\tfor _, x := range dpoints {\n")
+	sb.WriteString("\t\tfmt.Println(math.Float64bits(predict(x)))\n\t}\n}\n")
+	return sb.String()
+}
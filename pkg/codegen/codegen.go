@@ -0,0 +1,273 @@
+// Package codegen compiles trained trees and tree ensembles to standalone Go
+// source code. The generated file holds a prediction function that walks the
+// trees with nested if/else statements. It depends on the standard library
+// only and needs no model file, which suits low-latency deployments.
+package codegen
+
+import (
+	"fmt"
+	"go/format"
+	"math"
+	"strconv"
+	"strings"
+
+	"grokml/pkg/ch09-tree"
+	"grokml/pkg/ch12-ensemble"
+)
+
+// Predictor is the interface of the models that can be compiled.
+type Predictor interface {
+	Predict(dpoints [][]float64) []float64
+}
+
+// generator holds the source code generated so far.
+type generator struct {
+	name  string
+	body  strings.Builder // prediction function
+	funcs strings.Builder // helper functions
+	trees int
+}
+
+// Generate returns the Go source code of a file in package pkg with the
+// function
+//
+//	func name(x []float64) float64
+//
+// which predicts the label of a data point x exactly like the model's
+// Predict method. Supported models are TreeClassifier, TreeRegressor,
+// ForestClassifier, ForestRegressor, ExtraTreesClassifier,
+// ExtraTreesRegressor, AdaBoostClassifier and GradBoostRegressor.
+func Generate(model Predictor, pkg string, name string) ([]byte, error) {
+	g := &generator{name: name}
+	switch m := model.(type) {
+	case *ch09.TreeClassifier:
+		g.printf("return %s(x)\n", g.tree(m.Tree, classOf, "float64"))
+	case *ch09.TreeRegressor:
+		g.printf("return %s(x)\n", g.tree(m.Tree, labelOf, "float64"))
+	case *ch09.ForestClassifier:
+		g.forest(&m.Forest)
+	case *ch09.ExtraTreesClassifier:
+		g.forest(&m.Forest)
+	case *ch09.ForestRegressor:
+		g.average(m.Estimators)
+	case *ch09.ExtraTreesRegressor:
+		g.average(m.Estimators)
+	case *ch12.AdaBoostClassifier:
+		g.adaBoost(m)
+	case *ch12.GradBoostRegressor:
+		if err := g.gradBoost(m); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("cannot generate code for %T", model)
+	}
+	code := fmt.Sprintf("// %s predicts the label of the data point x.\n", name) +
+		fmt.Sprintf("func %s(x []float64) float64 {\n%s}\n\n", name, g.body.String()) +
+		g.funcs.String()
+	var src strings.Builder
+	src.WriteString("// Code generated by grokml/pkg/codegen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\n", pkg)
+	if strings.Contains(code, "math.") {
+		src.WriteString("import \"math\"\n\n")
+	}
+	src.WriteString(code)
+	return format.Source([]byte(src.String()))
+}
+
+// printf writes to the prediction function.
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// lit formats a float such that the Go literal parses to the same value.
+func lit(val float64) string {
+	switch {
+	case math.IsNaN(val):
+		return "math.NaN()"
+	case math.IsInf(val, 1):
+		return "math.Inf(1)"
+	case math.IsInf(val, -1):
+		return "math.Inf(-1)"
+	}
+	s := strconv.FormatFloat(val, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+// dist returns the class distribution of a leaf. Nodes of binary trees
+// trained without class distributions derive it from the label.
+func dist(nd *ch09.Node) []float64 {
+	if nd.Dist == nil {
+		return []float64{1.0 - nd.Label, nd.Label}
+	}
+	return nd.Dist
+}
+
+// classOf returns a leaf's majority class, the prediction of a classification tree.
+func classOf(nd *ch09.Node) string {
+	return lit(float64(ch09.Argmax(dist(nd))))
+}
+
+// labelOf returns a leaf's label, the prediction of a regression tree.
+func labelOf(nd *ch09.Node) string {
+	return lit(nd.Label)
+}
+
+// distOf returns a leaf's class distribution.
+func distOf(nd *ch09.Node) string {
+	var probs []string
+	for _, p := range dist(nd) {
+		probs = append(probs, lit(p))
+	}
+	return "[]float64{" + strings.Join(probs, ", ") + "}"
+}
+
+// condition returns the Go expression of the test that sends data points
+// left, which matches the routing of the trees.
+func condition(si ch09.SplitInfo) string {
+	x := fmt.Sprintf("x[%d]", si.Dimension)
+	var cond string
+	if si.Categories != nil {
+		tests := make([]string, len(si.Categories))
+		for i, cat := range si.Categories {
+			tests[i] = x + " == " + lit(cat)
+		}
+		cond = strings.Join(tests, " || ")
+	} else {
+		cond = x + " < " + lit(si.Threshold)
+	}
+	if si.MissingLeft {
+		cond += " || math.IsNaN(" + x + ")"
+	}
+	return cond
+}
+
+// tree generates the function of a tree, whose leaves return what leaf
+// makes of them, of type ret, and returns its name.
+func (g *generator) tree(dt ch09.Tree, leaf func(*ch09.Node) string, ret string) string {
+	name := fmt.Sprintf("%sTree%d", g.name, g.trees)
+	g.trees++
+	fmt.Fprintf(&g.funcs, "func %s(x []float64) %s {\n", name, ret)
+	var walk func(nd *ch09.Node)
+	walk = func(nd *ch09.Node) {
+		if nd.Left == nil {
+			fmt.Fprintf(&g.funcs, "return %s\n", leaf(nd))
+			return
+		}
+		fmt.Fprintf(&g.funcs, "if %s {\n", condition(nd.Split))
+		walk(nd.Left)
+		g.funcs.WriteString("}\n")
+		walk(nd.Right)
+	}
+	walk(dt.Root)
+	g.funcs.WriteString("}\n\n")
+	return name
+}
+
+// argmax generates the helper that picks the first greatest score. The
+// helpers are prefixed with the name of the prediction function, so that
+// several models can be compiled into the same package.
+func (g *generator) argmax() {
+	fmt.Fprintf(&g.funcs, `func %sArgmax(vals []float64) float64 {
+	var best int
+	for k, val := range vals {
+		if val > vals[best] {
+			best = k
+		}
+	}
+	return float64(best)
+}
+
+`, g.name)
+}
+
+// forest generates the majority vote of a forest's classification trees.
+func (g *generator) forest(f *ch09.Forest) {
+	nClasses := f.Classes
+	if nClasses < 2 {
+		nClasses = 2
+	}
+	g.printf("votes := make([]float64, %d)\n", nClasses)
+	for _, tree := range f.Estimators {
+		g.printf("votes[int(%s(x))]++\n", g.tree(tree.Tree, classOf, "float64"))
+	}
+	g.printf("return %sArgmax(votes)\n", g.name)
+	g.argmax()
+}
+
+// average generates the mean prediction of regression trees.
+func (g *generator) average(trees []*ch09.TreeRegressor) {
+	g.printf("var avg float64\n")
+	for _, tree := range trees {
+		g.printf("avg += %s(x)\n", g.tree(tree.Tree, labelOf, "float64"))
+	}
+	g.printf("return avg / %s\n", lit(float64(len(trees))))
+}
+
+// adaBoost generates the weighted vote of AdaBoost.
+func (g *generator) adaBoost(ad *ch12.AdaBoostClassifier) {
+	nClasses := ad.Classes
+	if nClasses < 2 {
+		nClasses = 2
+	}
+	g.printf("scores := make([]float64, %d)\n", nClasses)
+	for i, tree := range ad.Estimators {
+		if ad.Algorithm == ch12.SAMMER {
+			g.printf("%sSAMMER(scores, %s(x))\n", g.name, g.tree(tree.Tree, distOf, "[]float64"))
+		} else {
+			g.printf("scores[int(%s(x))] += %s\n", g.tree(tree.Tree, classOf, "float64"), lit(ad.Coeffs[i]))
+		}
+	}
+	g.printf(`if len(scores) == 2 {
+	if scores[1] >= scores[0] {
+		return 1.0
+	}
+	return 0.0
+}
+return %sArgmax(scores)
+`, g.name)
+	g.argmax()
+	if ad.Algorithm == ch12.SAMMER {
+		fmt.Fprintf(&g.funcs, `func %sSAMMER(scores []float64, dist []float64) {
+	const eps = 1e-10
+	nClasses := float64(len(scores))
+	var mean float64
+	logs := make([]float64, len(scores))
+	for k := range logs {
+		if k < len(dist) {
+			logs[k] = math.Log(math.Max(dist[k], eps))
+		} else {
+			logs[k] = math.Log(eps)
+		}
+		mean += logs[k] / nClasses
+	}
+	for k, logp := range logs {
+		scores[k] += (nClasses - 1.0) * (logp - mean)
+	}
+}
+
+`, g.name)
+	}
+}
+
+// gradBoost generates the sum of the boosted regression trees.
+func (g *generator) gradBoost(gb *ch12.GradBoostRegressor) error {
+	if len(gb.Init) != 1 {
+		return fmt.Errorf("cannot generate code for %d outputs", len(gb.Init))
+	}
+	g.printf("raw := %s\n", lit(gb.Init[0]))
+	for _, trees := range gb.Trees {
+		g.printf("raw += %s * %s(x)\n", lit(gb.LRate), g.tree(trees[0].Tree, labelOf, "float64"))
+	}
+	switch gb.Loss {
+	case ch12.PoissonLoss:
+		g.printf("return math.Exp(raw)\n")
+	case ch12.SquaredLoss, ch12.AbsoluteLoss, ch12.HuberLoss, ch12.QuantileLoss, "":
+		g.printf("return raw\n")
+	default:
+		return fmt.Errorf("cannot generate code for loss %q", gb.Loss)
+	}
+	return nil
+}
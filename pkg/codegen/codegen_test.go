@@ -0,0 +1,70 @@
+package codegen
+
+import (
+	"math"
+	"testing"
+
+	"grokml/pkg/ch09-tree"
+	"grokml/pkg/ch12-ensemble"
+)
+
+var (
+	dpoints = [][]float64{
+		{7, 1, 0}, {3, 2, 1}, {2, 3, 2}, {1, 5, 0}, {2, 6, 1}, {4, 7, 2},
+		{1, 9, 0}, {8, 10, 1}, {6, 5, 2}, {7, 8, 0}, {8, 4, 1}, {9, 6, 2},
+		{math.NaN(), 3, 1}, {5, math.NaN(), 0},
+	}
+	classes = []float64{2, 1, 0, 0, 1, 0, 0, 1, 2, 2, 1, 2, 1, 2}
+	labels  = []float64{1.5, 2.0, 2.5, 0.5, 4.0, 3.5, 6.0, 9.5, 7.0, 8.0, 8.5, 9.0, 3.0, 5.0}
+)
+
+func TestGenerate(t *testing.T) {
+	tree := ch09.NewTreeClassifier(ch09.Gini, 0.0)
+	tree.Categorical = []bool{false, false, true}
+	tree.Fit(dpoints, classes)
+
+	reg := ch09.NewTreeRegressor(0.0)
+	reg.Fit(dpoints, labels)
+
+	forest := ch09.NewForestClassifier(5, ch09.Entropy, 0.0)
+	forest.Seed = 7
+	forest.Fit(dpoints, classes)
+
+	extra := ch09.NewExtraTreesRegressor(4, 0.0)
+	extra.Fit(dpoints, labels)
+
+	samme := ch12.NewAdaBoostClassifier(4, ch09.Gini, 0.0)
+	samme.Fit(dpoints, classes)
+
+	sammer := ch12.NewAdaBoostClassifier(4, ch09.Gini, 0.0)
+	sammer.Algorithm = ch12.SAMMER
+	sammer.MaxDepth = 2
+	sammer.Fit(dpoints, classes)
+
+	gb := ch12.NewGradBoostRegressor(5, 0.0, 0.3)
+	if err := gb.Fit(dpoints, labels); err != nil {
+		t.Fatal(err)
+	}
+
+	poisson := ch12.NewGradBoostRegressor(5, 0.0, 0.3)
+	poisson.Loss = ch12.PoissonLoss
+	if err := poisson.Fit(dpoints, labels); err != nil {
+		t.Fatal(err)
+	}
+
+	models := map[string]Predictor{
+		"tree": &tree, "regressor": &reg, "forest": forest, "extratrees": extra,
+		"samme": samme, "samme.r": sammer, "gradboost": gb, "poisson": poisson,
+	}
+	for name, model := range models {
+		if err := Check(model, dpoints); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	if _, err := Generate(ch12.NewIsolationForest(2, 0.0), "main", "predict"); err == nil {
+		t.Error("expected an error for an isolation forest")
+	}
+}
@@ -0,0 +1,186 @@
+// Implements conformal prediction: calibrated prediction intervals around
+// the point predictions of any regressor.
+package conformal
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	pl "grokml/pkg/pipeline"
+)
+
+// Regressor is the interface of regressors that can be wrapped. Every
+// pipeline.Estimator satisfies it for its data point type D, e.g. ch03.LinReg
+// for vectors, and so do pipelines and the tree regressors and forests of
+// ch09 for slices of floats.
+type Regressor[D any] interface {
+	Predict(dpoints []D) []float64
+}
+
+// TrainFunc trains a fresh regressor on the given examples. It is used to
+// obtain out-of-fold residuals for CV+.
+type TrainFunc[D any] func(dpoints []D, labels []float64) Regressor[D]
+
+// Trainer returns the TrainFunc of the estimators made by newEst, eg
+//
+//	Trainer(func() pl.Estimator[vc.Vector] { return ch03.NewLinReg(1e-2, 1000) })
+func Trainer[O pl.OutType](newEst func() pl.Estimator[O]) TrainFunc[O] {
+	return func(dpoints []O, labels []float64) Regressor[O] {
+		est := newEst()
+		est.Fit(dpoints, labels)
+		return est
+	}
+}
+
+// ConformalRegressor wraps a regressor and predicts intervals that contain
+// the labels of new data points with probability at least 1 - Alpha, as long
+// as they are exchangeable with the examples it was fitted on. Residuals
+// holds the absolute residuals of these examples. With split conformal
+// prediction (Fit), they are computed by the trained base regressor on
+// held-out calibration examples; with CV+ (FitCV), by the regressors of
+// k-fold cross-validation on the examples of their fold, which is given by
+// Folds. Only Alpha and the residuals are persisted; the base regressor is
+// dumped and loaded on its own, and the fold regressors of CV+ are lost, so
+// that a loaded CV+ regressor predicts split conformal intervals around the
+// base predictions.
+type ConformalRegressor[D any] struct {
+	Base      Regressor[D]   `json:"-"`
+	Alpha     float64        `json:"alpha"`
+	Residuals []float64      `json:"residuals"`
+	Folds     []int          `json:"folds,omitempty"`
+	Models    []Regressor[D] `json:"-"`
+}
+
+// NewConformalRegressor is the constructor function for ConformalRegressor.
+// The base regressor may be nil if it is to be trained with FitCV.
+func NewConformalRegressor[D any](base Regressor[D], alpha float64) *ConformalRegressor[D] {
+	return &ConformalRegressor[D]{Base: base, Alpha: alpha}
+}
+
+// Fit performs split conformal calibration with the already trained base
+// regressor on held-out examples, ie examples that it was not trained on.
+func (cr *ConformalRegressor[D]) Fit(dpoints []D, labels []float64) {
+	cr.Residuals = make([]float64, len(dpoints))
+	for i, pred := range cr.Base.Predict(dpoints) {
+		cr.Residuals[i] = math.Abs(labels[i] - pred)
+	}
+	cr.Folds, cr.Models = nil, nil
+}
+
+// FitCV performs CV+ calibration (Barber et al., 2021): the examples are
+// split into k folds, and for every fold a regressor is trained on the
+// others, which computes the residuals of the fold. Example i belongs to
+// fold i % k. The base regressor is trained on all examples.
+func (cr *ConformalRegressor[D]) FitCV(train TrainFunc[D], k int, dpoints []D, labels []float64) {
+	cr.Residuals = make([]float64, len(dpoints))
+	cr.Folds = make([]int, len(dpoints))
+	cr.Models = make([]Regressor[D], k)
+	for fold := 0; fold < k; fold++ {
+		var trainPts, testPts []D
+		var trainLbs []float64
+		var testIdx []int
+		for i, dpoint := range dpoints {
+			if i%k == fold {
+				testPts = append(testPts, dpoint)
+				testIdx = append(testIdx, i)
+			} else {
+				trainPts = append(trainPts, dpoint)
+				trainLbs = append(trainLbs, labels[i])
+			}
+		}
+		if len(testPts) == 0 {
+			continue
+		}
+		cr.Models[fold] = train(trainPts, trainLbs)
+		for j, pred := range cr.Models[fold].Predict(testPts) {
+			i := testIdx[j]
+			cr.Residuals[i] = math.Abs(labels[i] - pred)
+			cr.Folds[i] = fold
+		}
+	}
+	cr.Base = train(dpoints, labels)
+}
+
+// Predict returns the point predictions of the base regressor.
+func (cr *ConformalRegressor[D]) Predict(dpoints []D) []float64 {
+	return cr.Base.Predict(dpoints)
+}
+
+// Score computes the coefficient of determination of the point predictions.
+func (cr *ConformalRegressor[D]) Score(dpoints []D, labels []float64) float64 {
+	return pl.GetCoD(cr.Predict(dpoints), labels)
+}
+
+// PredictInterval returns the bounds of the prediction intervals of the
+// data points. With split conformal prediction, they are the point
+// predictions minus and plus the ceil((1 - Alpha)(n + 1))-th smallest of
+// the n residuals. With CV+, every residual R_i is added to and subtracted
+// from the prediction of the regressor that did not see example i; the
+// bounds are the floor(Alpha (n + 1))-th smallest of the differences and
+// the ceil((1 - Alpha)(n + 1))-th smallest of the sums. Too few residuals
+// for the level make the bounds infinite.
+func (cr *ConformalRegressor[D]) PredictInterval(dpoints []D) ([]float64, []float64) {
+	n := len(cr.Residuals)
+	hi := int(math.Ceil((1.0 - cr.Alpha) * float64(n+1)))
+	lo := int(math.Floor(cr.Alpha * float64(n+1)))
+	lower := make([]float64, len(dpoints))
+	upper := make([]float64, len(dpoints))
+	if cr.Folds == nil || len(cr.Models) == 0 {
+		width := math.Inf(1)
+		if hi <= n {
+			sorted := append([]float64(nil), cr.Residuals...)
+			sort.Float64s(sorted)
+			width = sorted[hi-1]
+		}
+		for j, pred := range cr.Predict(dpoints) {
+			lower[j], upper[j] = pred-width, pred+width
+		}
+		return lower, upper
+	}
+	foldPreds := make([][]float64, len(cr.Models))
+	for fold, model := range cr.Models {
+		if model != nil {
+			foldPreds[fold] = model.Predict(dpoints)
+		}
+	}
+	diffs := make([]float64, n)
+	sums := make([]float64, n)
+	for j := range dpoints {
+		for i, res := range cr.Residuals {
+			pred := foldPreds[cr.Folds[i]][j]
+			diffs[i], sums[i] = pred-res, pred+res
+		}
+		lower[j], upper[j] = math.Inf(-1), math.Inf(1)
+		if lo >= 1 {
+			sort.Float64s(diffs)
+			lower[j] = diffs[lo-1]
+		}
+		if hi <= n {
+			sort.Float64s(sums)
+			upper[j] = sums[hi-1]
+		}
+	}
+	return lower, upper
+}
+
+// Coverage returns the share of the labels that lie within their intervals,
+// which should be at least 1 - Alpha on new data.
+func Coverage(lower, upper, labels []float64) float64 {
+	var covered float64
+	for i, label := range labels {
+		if lower[i] <= label && label <= upper[i] {
+			covered++
+		}
+	}
+	return covered / float64(len(labels))
+}
+
+// Marshal and Unmarshal implement the JSONable interface (persist pkg).
+func (cr ConformalRegressor[D]) Marshal() ([]byte, error) {
+	return json.MarshalIndent(cr, "", "    ")
+}
+
+func (cr *ConformalRegressor[D]) Unmarshal(bs []byte) error {
+	return json.Unmarshal(bs, cr)
+}
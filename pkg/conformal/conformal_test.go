@@ -0,0 +1,90 @@
+package conformal
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"grokml/pkg/ch03-linreg"
+	"grokml/pkg/ch09-tree"
+	pl "grokml/pkg/pipeline"
+	vc "grokml/pkg/vector"
+)
+
+// linear is a helper function that draws noisy labels of a linear function.
+func linear(rng *rand.Rand, n int) ([][]float64, []float64) {
+	dpoints := make([][]float64, n)
+	labels := make([]float64, n)
+	for i := range dpoints {
+		x := rng.Float64()
+		dpoints[i] = []float64{x}
+		labels[i] = 4.0*x + 1.0 + 0.5*rng.NormFloat64()
+	}
+	return dpoints, labels
+}
+
+func TestSplitConformal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	trainPts, trainLbs := linear(rng, 500)
+	calPts, calLbs := linear(rng, 500)
+	testPts, testLbs := linear(rng, 2000)
+
+	fr := ch09.NewForestRegressor(10, 0.0)
+	for _, tree := range fr.Estimators {
+		tree.MinSamplesLeaf = 20
+	}
+	fr.Fit(trainPts, trainLbs)
+	cr := NewConformalRegressor[[]float64](fr, 0.1)
+	cr.Fit(calPts, calLbs)
+	lower, upper := cr.PredictInterval(testPts)
+	if cov := Coverage(lower, upper, testLbs); cov < 0.87 || cov > 0.93 {
+		t.Errorf("expected a coverage of about 0.9, got %.3f", cov)
+	}
+	// The noise alone needs a width of 2 * 1.645 * 0.5.
+	if width := upper[0] - lower[0]; width < 1.5 || width > 2.5 {
+		t.Errorf("expected an interval width of about 1.65, got %.3f", width)
+	}
+
+	bs, err := cr.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cr2 := NewConformalRegressor[[]float64](fr, 0.0)
+	if err := cr2.Unmarshal(bs); err != nil {
+		t.Fatal(err)
+	}
+	lower2, upper2 := cr2.PredictInterval(testPts[:1])
+	if lower2[0] != lower[0] || upper2[0] != upper[0] {
+		t.Errorf("expected [%v, %v], got [%v, %v]", lower[0], upper[0], lower2[0], upper2[0])
+	}
+}
+
+func TestCVPlus(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	dpoints, labels := linear(rng, 400)
+	testPts, testLbs := linear(rng, 2000)
+	vecs := func(dpoints [][]float64) []vc.Vector {
+		vecs := make([]vc.Vector, len(dpoints))
+		for i, dpoint := range dpoints {
+			vecs[i] = dpoint
+		}
+		return vecs
+	}
+
+	rand.Seed(1)
+	cr := NewConformalRegressor[vc.Vector](nil, 0.1)
+	cr.FitCV(Trainer(func() pl.Estimator[vc.Vector] { return ch03.NewLinReg(0.1, 200) }), 5, vecs(dpoints), labels)
+	if r2 := cr.Score(vecs(testPts), testLbs); r2 < 0.8 {
+		t.Errorf("expected R2 score above 0.8, got %.3f", r2)
+	}
+	lower, upper := cr.PredictInterval(vecs(testPts))
+	if cov := Coverage(lower, upper, testLbs); cov < 0.87 || cov > 0.94 {
+		t.Errorf("expected a coverage of about 0.9, got %.3f", cov)
+	}
+	// Too few residuals for the level give infinite bounds.
+	cr.Alpha = 0.001
+	lower, upper = cr.PredictInterval(vecs(testPts[:1]))
+	if !math.IsInf(lower[0], -1) || !math.IsInf(upper[0], 1) {
+		t.Errorf("expected infinite bounds, got [%v, %v]", lower[0], upper[0])
+	}
+}
@@ -0,0 +1,226 @@
+// Implements performance measures for classifiers and regressors.
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// Average selects how per-class quantities are averaged over the classes.
+type Average int
+
+const (
+	// Macro averages the per-class quantities with equal weights.
+	Macro Average = iota
+	// Micro computes the quantities from the pooled counts of all classes.
+	Micro
+	// Weighted averages the per-class quantities weighted with the class sizes.
+	Weighted
+)
+
+// ConfusionMatrix holds the counts of examples of true class Classes[i]
+// predicted as class Classes[j] in Counts[i][j]. The classes are sorted.
+type ConfusionMatrix struct {
+	Classes []float64   `json:"classes"`
+	Counts  [][]float64 `json:"counts"`
+}
+
+// NewConfusionMatrix computes the confusion matrix of the predicted labels.
+// The classes are the distinct values found among predictions and labels.
+func NewConfusionMatrix(predictions []float64, labels []float64) ConfusionMatrix {
+	seen := map[float64]bool{}
+	var classes []float64
+	for _, vals := range [][]float64{labels, predictions} {
+		for _, val := range vals {
+			if !seen[val] {
+				seen[val] = true
+				classes = append(classes, val)
+			}
+		}
+	}
+	sort.Float64s(classes)
+	index := make(map[float64]int, len(classes))
+	for i, class := range classes {
+		index[class] = i
+	}
+	counts := make([][]float64, len(classes))
+	for i := range counts {
+		counts[i] = make([]float64, len(classes))
+	}
+	for i, pred := range predictions {
+		counts[index[labels[i]]][index[pred]]++
+	}
+	return ConfusionMatrix{Classes: classes, Counts: counts}
+}
+
+// Total returns the number of examples.
+func (cm ConfusionMatrix) Total() float64 {
+	var total float64
+	for _, row := range cm.Counts {
+		for _, count := range row {
+			total += count
+		}
+	}
+	return total
+}
+
+// support returns the number of examples per true class.
+func (cm ConfusionMatrix) support() []float64 {
+	sup := make([]float64, len(cm.Classes))
+	for i, row := range cm.Counts {
+		for _, count := range row {
+			sup[i] += count
+		}
+	}
+	return sup
+}
+
+// predicted returns the number of examples per predicted class.
+func (cm ConfusionMatrix) predicted() []float64 {
+	pred := make([]float64, len(cm.Classes))
+	for _, row := range cm.Counts {
+		for j, count := range row {
+			pred[j] += count
+		}
+	}
+	return pred
+}
+
+// Accuracy returns the fraction of correctly predicted examples.
+func (cm ConfusionMatrix) Accuracy() float64 {
+	var correct float64
+	for i := range cm.Classes {
+		correct += cm.Counts[i][i]
+	}
+	return div(correct, cm.Total())
+}
+
+// Precisions returns the precision for every class.
+func (cm ConfusionMatrix) Precisions() []float64 {
+	pred := cm.predicted()
+	res := make([]float64, len(cm.Classes))
+	for i := range res {
+		res[i] = div(cm.Counts[i][i], pred[i])
+	}
+	return res
+}
+
+// Recalls returns the recall for every class.
+func (cm ConfusionMatrix) Recalls() []float64 {
+	sup := cm.support()
+	res := make([]float64, len(cm.Classes))
+	for i := range res {
+		res[i] = div(cm.Counts[i][i], sup[i])
+	}
+	return res
+}
+
+// FScores returns the F-score for every class.
+func (cm ConfusionMatrix) FScores(beta float64) []float64 {
+	precs, recs := cm.Precisions(), cm.Recalls()
+	res := make([]float64, len(cm.Classes))
+	for i := range res {
+		res[i] = fscore(beta, precs[i], recs[i])
+	}
+	return res
+}
+
+// Precision averages the precisions of the classes.
+func (cm ConfusionMatrix) Precision(avg Average) float64 {
+	return cm.average(cm.Precisions(), avg)
+}
+
+// Recall averages the recalls of the classes.
+func (cm ConfusionMatrix) Recall(avg Average) float64 {
+	return cm.average(cm.Recalls(), avg)
+}
+
+// FScore averages the F-scores of the classes. The micro-averaged F-score
+// is computed from the micro-averaged precision and recall.
+func (cm ConfusionMatrix) FScore(beta float64, avg Average) float64 {
+	if avg == Micro {
+		return fscore(beta, cm.Precision(Micro), cm.Recall(Micro))
+	}
+	return cm.average(cm.FScores(beta), avg)
+}
+
+// average is a helper method that averages per-class quantities. Micro
+// averages of precision and recall both equal the accuracy when every
+// example has exactly one class.
+func (cm ConfusionMatrix) average(vals []float64, avg Average) float64 {
+	switch avg {
+	case Micro:
+		return cm.Accuracy()
+	case Weighted:
+		sup := cm.support()
+		var sum float64
+		for i, val := range vals {
+			sum += sup[i] * val
+		}
+		return div(sum, cm.Total())
+	default:
+		return mean(vals)
+	}
+}
+
+// BalancedAccuracy returns the macro-averaged recall, which is insensitive
+// to class imbalance.
+func (cm ConfusionMatrix) BalancedAccuracy() float64 {
+	return mean(cm.Recalls())
+}
+
+// MCC computes the Matthews correlation coefficient in its multiclass form
+// (Gorodkin's R_K statistic). It ranges from -1 to 1, where 0 is chance level.
+func (cm ConfusionMatrix) MCC() float64 {
+	total := cm.Total()
+	sup, pred := cm.support(), cm.predicted()
+	var correct, sumPT, sumPP, sumTT float64
+	for i := range cm.Classes {
+		correct += cm.Counts[i][i]
+		sumPT += pred[i] * sup[i]
+		sumPP += pred[i] * pred[i]
+		sumTT += sup[i] * sup[i]
+	}
+	numerator := correct*total - sumPT
+	denominator := math.Sqrt((total*total - sumPP) * (total*total - sumTT))
+	return div(numerator, denominator)
+}
+
+// CohenKappa computes Cohen's kappa, the agreement between predictions and
+// labels corrected for the agreement expected by chance.
+func (cm ConfusionMatrix) CohenKappa() float64 {
+	total := cm.Total()
+	sup, pred := cm.support(), cm.predicted()
+	var expected float64
+	for i := range cm.Classes {
+		expected += sup[i] * pred[i] / (total * total)
+	}
+	observed := cm.Accuracy()
+	return div(observed-expected, 1.0-expected)
+}
+
+// fscore is a helper function combining precision and recall as in
+// pipeline.Report.FScore.
+func fscore(beta, precision, recall float64) float64 {
+	return div((1+beta*beta)*precision*recall, beta*beta*precision+recall)
+}
+
+// div is a helper function that returns 0 when dividing by zero.
+func div(numerator, denominator float64) float64 {
+	if denominator == 0.0 {
+		return 0.0
+	}
+	return numerator / denominator
+}
+
+// mean is a helper function to compute the average value of a slice.
+func mean(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0.0
+	}
+	var sum float64
+	for _, val := range vals {
+		sum += val
+	}
+	return sum / float64(len(vals))
+}
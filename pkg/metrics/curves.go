@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// ROC holds the points of a receiver operating characteristic curve: the
+// false-positive and true-positive rates obtained by labelling examples with
+// a score of at least Thresholds[i] as positive. The first point (0, 0)
+// has the threshold +Inf.
+type ROC struct {
+	FPR        []float64 `json:"fpr"`
+	TPR        []float64 `json:"tpr"`
+	Thresholds []float64 `json:"thresholds"`
+}
+
+// PR holds the points of a precision-recall curve, ordered by decreasing
+// threshold. The first point has recall 0, precision 1 and threshold +Inf.
+type PR struct {
+	Precision  []float64 `json:"precision"`
+	Recall     []float64 `json:"recall"`
+	Thresholds []float64 `json:"thresholds"`
+}
+
+// cumulative is a helper function that sorts the examples once by decreasing
+// score and returns, for every distinct score, the number of true and false
+// positives among the examples with at least that score. Labels above 0.5
+// count as positive.
+func cumulative(scores []float64, labels []float64) (tps, fps, thresholds []float64) {
+	idx := make([]int, len(scores))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return scores[idx[i]] > scores[idx[j]] })
+	var tp, fp float64
+	for k, i := range idx {
+		if labels[i] > 0.5 {
+			tp++
+		} else {
+			fp++
+		}
+		// emit a point only after the last example with this score
+		if k+1 < len(idx) && scores[idx[k+1]] == scores[i] {
+			continue
+		}
+		tps = append(tps, tp)
+		fps = append(fps, fp)
+		thresholds = append(thresholds, scores[i])
+	}
+	return tps, fps, thresholds
+}
+
+// ROCCurve computes the ROC curve of the scores, e.g. probabilities of the
+// positive class, with a single sort.
+func ROCCurve(scores []float64, labels []float64) ROC {
+	tps, fps, ths := cumulative(scores, labels)
+	roc := ROC{FPR: []float64{0}, TPR: []float64{0}, Thresholds: []float64{math.Inf(1)}}
+	if len(tps) == 0 {
+		return roc
+	}
+	pos, neg := tps[len(tps)-1], fps[len(fps)-1]
+	for i, th := range ths {
+		roc.FPR = append(roc.FPR, div(fps[i], neg))
+		roc.TPR = append(roc.TPR, div(tps[i], pos))
+		roc.Thresholds = append(roc.Thresholds, th)
+	}
+	return roc
+}
+
+// AUC computes the area under a curve given by its points with the
+// trapezoidal rule. The x values must be monotonic.
+func AUC(xs []float64, ys []float64) float64 {
+	var area float64
+	for i := 1; i < len(xs); i++ {
+		area += (xs[i] - xs[i-1]) * (ys[i] + ys[i-1]) / 2.0
+	}
+	return math.Abs(area)
+}
+
+// ROCAUC computes the area under the ROC curve of the scores.
+func ROCAUC(scores []float64, labels []float64) float64 {
+	roc := ROCCurve(scores, labels)
+	return AUC(roc.FPR, roc.TPR)
+}
+
+// PRCurve computes the precision-recall curve of the scores with a single sort.
+func PRCurve(scores []float64, labels []float64) PR {
+	tps, fps, ths := cumulative(scores, labels)
+	pr := PR{Precision: []float64{1}, Recall: []float64{0}, Thresholds: []float64{math.Inf(1)}}
+	if len(tps) == 0 {
+		return pr
+	}
+	pos := tps[len(tps)-1]
+	for i, th := range ths {
+		pr.Precision = append(pr.Precision, tps[i]/(tps[i]+fps[i]))
+		pr.Recall = append(pr.Recall, div(tps[i], pos))
+		pr.Thresholds = append(pr.Thresholds, th)
+	}
+	return pr
+}
+
+// AveragePrecision summarises the precision-recall curve as the mean of the
+// precisions at every threshold weighted with the increase in recall.
+func AveragePrecision(scores []float64, labels []float64) float64 {
+	pr := PRCurve(scores, labels)
+	var ap float64
+	for i := 1; i < len(pr.Recall); i++ {
+		ap += (pr.Recall[i] - pr.Recall[i-1]) * pr.Precision[i]
+	}
+	return ap
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestConfusionMatrix(t *testing.T) {
+	labels := []float64{0, 0, 0, 1, 1, 2, 2, 2, 2, 2}
+	preds := []float64{0, 0, 1, 1, 2, 2, 2, 2, 0, 2}
+	cm := NewConfusionMatrix(preds, labels)
+	expCounts := [][]float64{{2, 1, 0}, {0, 1, 1}, {1, 0, 4}}
+	for i, row := range expCounts {
+		for j, count := range row {
+			if cm.Counts[i][j] != count {
+				t.Errorf("expected count %v at (%d, %d), got %v", count, i, j, cm.Counts[i][j])
+			}
+		}
+	}
+	cases := []struct {
+		name     string
+		got, exp float64
+	}{
+		{"accuracy", cm.Accuracy(), 0.7},
+		{"macro precision", cm.Precision(Macro), (2.0/3 + 0.5 + 0.8) / 3},
+		{"micro recall", cm.Recall(Micro), 0.7},
+		{"weighted recall", cm.Recall(Weighted), 0.7},
+		{"macro F1", cm.FScore(1.0, Macro), (2.0/3 + 0.5 + 0.8) / 3},
+		{"balanced accuracy", cm.BalancedAccuracy(), (2.0/3 + 0.5 + 0.8) / 3},
+		{"kappa", cm.CohenKappa(), (0.7 - 0.38) / (1 - 0.38)},
+	}
+	for _, c := range cases {
+		if math.Abs(c.got-c.exp) > 1e-9 {
+			t.Errorf("expected %s %.6f, got %.6f", c.name, c.exp, c.got)
+		}
+	}
+	// Binary MCC agrees with the textbook formula.
+	cm = NewConfusionMatrix([]float64{1, 1, 0, 0, 1}, []float64{1, 0, 0, 0, 1})
+	tp, tn, fp, fn := 2.0, 2.0, 1.0, 0.0
+	exp := (tp*tn - fp*fn) / math.Sqrt((tp+fp)*(tp+fn)*(tn+fp)*(tn+fn))
+	if math.Abs(cm.MCC()-exp) > 1e-9 {
+		t.Errorf("expected MCC %.6f, got %.6f", exp, cm.MCC())
+	}
+}
+
+func TestROCCurve(t *testing.T) {
+	scores := []float64{0.1, 0.4, 0.35, 0.8}
+	labels := []float64{0, 0, 1, 1}
+	roc := ROCCurve(scores, labels)
+	expFPR := []float64{0, 0, 0.5, 0.5, 1}
+	expTPR := []float64{0, 0.5, 0.5, 1, 1}
+	for i := range expFPR {
+		if roc.FPR[i] != expFPR[i] || roc.TPR[i] != expTPR[i] {
+			t.Errorf("expected point (%v, %v), got (%v, %v)", expFPR[i], expTPR[i], roc.FPR[i], roc.TPR[i])
+		}
+	}
+	if auc := ROCAUC(scores, labels); auc != 0.75 {
+		t.Errorf("expected AUC 0.75, got %v", auc)
+	}
+	// Tied scores give a single diagonal step.
+	if auc := ROCAUC([]float64{0.5, 0.5}, []float64{0, 1}); auc != 0.5 {
+		t.Errorf("expected AUC 0.5, got %v", auc)
+	}
+}
+
+func TestAveragePrecision(t *testing.T) {
+	scores := []float64{0.1, 0.4, 0.35, 0.8}
+	labels := []float64{0, 0, 1, 1}
+	exp := 0.5*1.0 + 0.5*2.0/3.0
+	if ap := AveragePrecision(scores, labels); math.Abs(ap-exp) > 1e-9 {
+		t.Errorf("expected average precision %.6f, got %.6f", exp, ap)
+	}
+}
+
+func TestLogLoss(t *testing.T) {
+	probs := []float64{0.9, 0.2}
+	labels := []float64{1, 0}
+	exp := -(math.Log(0.9) + math.Log(0.8)) / 2
+	if got := LogLoss(probs, labels); math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected log loss %.6f, got %.6f", exp, got)
+	}
+	dists := [][]float64{{0.9, 0.1}, {0.2, 0.8}}
+	if got := MultiLogLoss(dists, []float64{0, 1}); math.Abs(got-exp) > 1e-9 {
+		t.Errorf("expected multiclass log loss %.6f, got %.6f", exp, got)
+	}
+	if got := BrierScore(probs, labels); math.Abs(got-0.025) > 1e-9 {
+		t.Errorf("expected Brier score 0.025, got %.6f", got)
+	}
+}
+
+func TestRegressionMetrics(t *testing.T) {
+	preds := []float64{2.5, 0.0, 2.0, 8.0}
+	labels := []float64{3.0, -0.5, 2.0, 7.0}
+	cases := []struct {
+		name     string
+		got, exp float64
+	}{
+		{"MAE", MAE(preds, labels), 0.5},
+		{"RMSE", RMSE(preds, labels), math.Sqrt(0.375)},
+		{"median AE", MedianAE(preds, labels), 0.5},
+		{"max error", MaxError(preds, labels), 1.0},
+		{"R2", R2(preds, labels), 0.948608137},
+		{"explained variance", ExplainedVariance(preds, labels), 0.957173448},
+		{"MAPE", MAPE([]float64{90, 110}, []float64{100, 100}), 0.1},
+		{"Poisson deviance", MeanPoissonDeviance([]float64{2, 2}, []float64{2, 2}), 0.0},
+		{"Gamma deviance", MeanGammaDeviance([]float64{1}, []float64{2}), 2.0 * (math.Log(0.5) + 1.0)},
+	}
+	for _, c := range cases {
+		if math.Abs(c.got-c.exp) > 1e-6 {
+			t.Errorf("expected %s %.6f, got %.6f", c.name, c.exp, c.got)
+		}
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	// Residuals alternate in sign and grow with the predictions.
+	var preds, labels []float64
+	for i := 1; i <= 50; i++ {
+		x := float64(i)
+		sign := 1.0
+		if i%2 == 0 {
+			sign = -1.0
+		}
+		preds = append(preds, x)
+		labels = append(labels, x+sign*0.1*x)
+	}
+	diag := Diagnose(preds, labels)
+	if diag.DurbinWatson < 3.5 {
+		t.Errorf("expected Durbin-Watson statistic close to 4, got %.3f", diag.DurbinWatson)
+	}
+	if diag.PValue > 0.01 {
+		t.Errorf("expected heteroscedasticity with p-value below 0.01, got %.4f", diag.PValue)
+	}
+	lo, hi := diag.Quantiles[0], diag.Quantiles[len(diag.Quantiles)-1]
+	if math.Abs(lo+5.0) > 1e-9 || math.Abs(hi-4.9) > 1e-9 {
+		t.Errorf("expected residual range [-5, 4.9], got %v", diag.Quantiles)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import "math"
+
+// eps keeps probabilities away from 0 and 1 before taking logarithms.
+const eps = 1e-15
+
+// clip is a helper function that keeps a probability inside [eps, 1-eps].
+func clip(p float64) float64 {
+	return math.Max(eps, math.Min(1.0-eps, p))
+}
+
+// LogLoss computes the mean cross-entropy of the probabilities of the
+// positive class against the binary labels.
+func LogLoss(probs []float64, labels []float64) float64 {
+	var sum float64
+	for i, p := range probs {
+		p = clip(p)
+		if labels[i] > 0.5 {
+			sum -= math.Log(p)
+		} else {
+			sum -= math.Log(1.0 - p)
+		}
+	}
+	return sum / float64(len(probs))
+}
+
+// MultiLogLoss computes the mean cross-entropy of class distributions against
+// the labels, which are the class indices 0, 1, ..., K-1.
+func MultiLogLoss(probs [][]float64, labels []float64) float64 {
+	var sum float64
+	for i, dist := range probs {
+		sum -= math.Log(clip(dist[int(labels[i])]))
+	}
+	return sum / float64(len(probs))
+}
+
+// BrierScore computes the mean squared difference between the predicted
+// probabilities of the positive class and the binary labels. The lower,
+// the better.
+func BrierScore(probs []float64, labels []float64) float64 {
+	var sum float64
+	for i, p := range probs {
+		sum += (p - labels[i]) * (p - labels[i])
+	}
+	return sum / float64(len(probs))
+}
@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+)
+
+// MAE computes the mean absolute error.
+func MAE(predictions []float64, labels []float64) float64 {
+	var sum float64
+	for i, pred := range predictions {
+		sum += math.Abs(pred - labels[i])
+	}
+	return sum / float64(len(predictions))
+}
+
+// MSE computes the mean squared error.
+func MSE(predictions []float64, labels []float64) float64 {
+	var sum float64
+	for i, pred := range predictions {
+		sum += (pred - labels[i]) * (pred - labels[i])
+	}
+	return sum / float64(len(predictions))
+}
+
+// RMSE computes the root of the mean squared error.
+func RMSE(predictions []float64, labels []float64) float64 {
+	return math.Sqrt(MSE(predictions, labels))
+}
+
+// MAPE computes the mean absolute percentage error as a fraction. Labels
+// close to zero are guarded by a tiny denominator.
+func MAPE(predictions []float64, labels []float64) float64 {
+	var sum float64
+	for i, pred := range predictions {
+		sum += math.Abs(pred-labels[i]) / math.Max(math.Abs(labels[i]), eps)
+	}
+	return sum / float64(len(predictions))
+}
+
+// MedianAE computes the median absolute error, which is robust to outliers.
+func MedianAE(predictions []float64, labels []float64) float64 {
+	errs := make([]float64, len(predictions))
+	for i, pred := range predictions {
+		errs[i] = math.Abs(pred - labels[i])
+	}
+	return Quantile(errs, 0.5)
+}
+
+// MaxError computes the largest absolute error.
+func MaxError(predictions []float64, labels []float64) float64 {
+	var max float64
+	for i, pred := range predictions {
+		max = math.Max(max, math.Abs(pred-labels[i]))
+	}
+	return max
+}
+
+// R2 computes the coefficient of determination: one minus the ratio of the
+// residual sum of squares and the total sum of squares around the label mean.
+func R2(predictions []float64, labels []float64) float64 {
+	ym := mean(labels)
+	var rss, tss float64
+	for i, pred := range predictions {
+		rss += (labels[i] - pred) * (labels[i] - pred)
+		tss += (labels[i] - ym) * (labels[i] - ym)
+	}
+	return 1.0 - div(rss, tss)
+}
+
+// ExplainedVariance computes one minus the ratio of the residual variance and
+// the label variance. Unlike R2, it ignores a constant bias of the predictions.
+func ExplainedVariance(predictions []float64, labels []float64) float64 {
+	residuals := Residuals(predictions, labels)
+	return 1.0 - div(variance(residuals), variance(labels))
+}
+
+// MeanPoissonDeviance computes the mean Poisson deviance, suitable for count
+// data. Predictions must be positive and labels non-negative.
+func MeanPoissonDeviance(predictions []float64, labels []float64) float64 {
+	var sum float64
+	for i, pred := range predictions {
+		y := labels[i]
+		var term float64
+		if y > 0 {
+			term = y * math.Log(y/pred)
+		}
+		sum += 2.0 * (term - y + pred)
+	}
+	return sum / float64(len(predictions))
+}
+
+// MeanGammaDeviance computes the mean Gamma deviance, suitable for positive
+// data with a spread that grows with the mean, such as prices. Predictions and
+// labels must be positive.
+func MeanGammaDeviance(predictions []float64, labels []float64) float64 {
+	var sum float64
+	for i, pred := range predictions {
+		y := labels[i]
+		sum += 2.0 * (math.Log(pred/y) + y/pred - 1.0)
+	}
+	return sum / float64(len(predictions))
+}
+
+// Quantile computes the q-quantile of the values by linear interpolation
+// between the closest ranks. The values are left untouched.
+func Quantile(vals []float64, q float64) float64 {
+	if len(vals) == 0 {
+		return math.NaN()
+	}
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+	return quantileSorted(sorted, q)
+}
+
+// quantileSorted is a helper function computing the q-quantile of sorted values.
+func quantileSorted(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	hi := int(math.Ceil(pos))
+	if lo < 0 {
+		return sorted[0]
+	} else if hi >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+// variance is a helper function computing the population variance.
+func variance(vals []float64) float64 {
+	m := mean(vals)
+	var sum float64
+	for _, val := range vals {
+		sum += (val - m) * (val - m)
+	}
+	return sum / float64(len(vals))
+}
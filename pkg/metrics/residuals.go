@@ -0,0 +1,101 @@
+package metrics
+
+import "math"
+
+// Regressor is the interface of regressors whose residuals can be diagnosed,
+// e.g. ch03.LinReg for vectors and ch09.TreeRegressor or
+// ch12.GradBoostRegressor for slices of floats.
+type Regressor[D any] interface {
+	Predict(dpoints []D) []float64
+}
+
+// Diagnostics summarises the residuals of a regressor.
+// Quantiles holds the residual quantiles at the levels of QuantileLevels.
+// BreuschPagan is the Lagrange-multiplier statistic of the (studentised)
+// Breusch-Pagan test that regresses the squared residuals on the predictions;
+// a small PValue hints at heteroscedasticity, ie residuals whose spread
+// depends on the predicted value. DurbinWatson lies close to 2 if the
+// residuals of consecutive examples are uncorrelated.
+type Diagnostics struct {
+	Quantiles    []float64 `json:"quantiles"`
+	BreuschPagan float64   `json:"breusch_pagan"`
+	PValue       float64   `json:"p_value"`
+	DurbinWatson float64   `json:"durbin_watson"`
+}
+
+// QuantileLevels are the levels of the residual quantiles in Diagnostics.
+var QuantileLevels = []float64{0.0, 0.05, 0.25, 0.5, 0.75, 0.95, 1.0}
+
+// Residuals returns the differences between labels and predictions.
+func Residuals(predictions []float64, labels []float64) []float64 {
+	res := make([]float64, len(predictions))
+	for i, pred := range predictions {
+		res[i] = labels[i] - pred
+	}
+	return res
+}
+
+// Diagnose computes the residual diagnostics of the predictions.
+func Diagnose(predictions []float64, labels []float64) Diagnostics {
+	residuals := Residuals(predictions, labels)
+	quantiles := make([]float64, len(QuantileLevels))
+	for i, q := range QuantileLevels {
+		quantiles[i] = Quantile(residuals, q)
+	}
+	lm, pval := BreuschPagan(predictions, residuals)
+	return Diagnostics{
+		Quantiles:    quantiles,
+		BreuschPagan: lm,
+		PValue:       pval,
+		DurbinWatson: DurbinWatson(residuals),
+	}
+}
+
+// DiagnoseRegressor computes the residual diagnostics of the regressor on
+// the given examples.
+func DiagnoseRegressor[D any](reg Regressor[D], dpoints []D, labels []float64) Diagnostics {
+	return Diagnose(reg.Predict(dpoints), labels)
+}
+
+// BreuschPagan performs Koenker's studentised Breusch-Pagan test with the
+// predictions as the only explanatory variable. The statistic n*R², where R²
+// is that of the regression of the squared residuals on the predictions,
+// follows a chi-squared distribution with one degree of freedom if the
+// residuals are homoscedastic. It returns the statistic and its p-value.
+func BreuschPagan(predictions []float64, residuals []float64) (float64, float64) {
+	n := float64(len(residuals))
+	sq := make([]float64, len(residuals))
+	for i, r := range residuals {
+		sq[i] = r * r
+	}
+	// simple least-squares regression sq = a + b * prediction
+	xm, ym := mean(predictions), mean(sq)
+	var sxy, sxx float64
+	for i, x := range predictions {
+		sxy += (x - xm) * (sq[i] - ym)
+		sxx += (x - xm) * (x - xm)
+	}
+	b := div(sxy, sxx)
+	fitted := make([]float64, len(sq))
+	for i, x := range predictions {
+		fitted[i] = ym + b*(x-xm)
+	}
+	lm := n * R2(fitted, sq)
+	// survival function of the chi-squared distribution with one dof
+	pval := math.Erfc(math.Sqrt(lm / 2.0))
+	return lm, pval
+}
+
+// DurbinWatson computes the Durbin-Watson statistic of the residuals in
+// their given order. It ranges from 0 (positive autocorrelation) to 4
+// (negative autocorrelation).
+func DurbinWatson(residuals []float64) float64 {
+	var num, den float64
+	for i, r := range residuals {
+		if i > 0 {
+			num += (r - residuals[i-1]) * (r - residuals[i-1])
+		}
+		den += r * r
+	}
+	return div(num, den)
+}
@@ -0,0 +1,150 @@
+package persist
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Lock files not refreshed for staleLock are considered abandoned by a
+// crashed process and are removed. Their owners refresh them every
+// lockRefresh. Acquiring a lock gives up after lockTimeout.
+const (
+	staleLock   = 30 * time.Second
+	lockRefresh = 5 * time.Second
+	lockTimeout = 10 * time.Second
+	lockPoll    = 10 * time.Millisecond
+)
+
+// lockSeq makes the tokens of the locks of a process unique.
+var lockSeq uint64
+
+// lock acquires an exclusive lock on the given path by creating the lock
+// file path + ".lock", which holds a token of its owner. It returns a
+// function that releases the lock. While the lock is held, its file is
+// refreshed so that long writes do not make it stale, and it is only
+// removed as long as it holds the owner's token.
+func lock(path string) (func(), error) {
+	lockPath := path + ".lock"
+	token := fmt.Sprintf("%d-%d-%d", os.Getpid(), time.Now().UnixNano(), atomic.AddUint64(&lockSeq, 1))
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if err == nil {
+			_, err = file.WriteString(token)
+			file.Close()
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("cannot write lock file %s: %v", lockPath, err)
+			}
+			return hold(lockPath, token), nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("cannot create lock file %s: %v", lockPath, err)
+		}
+		breakStale(lockPath)
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("cannot acquire lock %s: timeout", lockPath)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// hold refreshes the lock file with the given token until the returned
+// function is called, which removes it.
+func hold(lockPath, token string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if owns(lockPath, token) {
+					now := time.Now()
+					os.Chtimes(lockPath, now, now)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		if owns(lockPath, token) {
+			os.Remove(lockPath)
+		}
+	}
+}
+
+// owns reports whether the lock file holds the token.
+func owns(lockPath, token string) bool {
+	bs, err := os.ReadFile(lockPath)
+	return err == nil && string(bs) == token
+}
+
+// isStale reports whether the file has not been modified for staleLock.
+func isStale(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > staleLock
+}
+
+// breakStale removes the lock file if it is stale. Waiters that find it
+// stale at the same time take turns by means of the file lockPath +
+// ".break" and check again before removing it, lest one of them remove
+// the lock just acquired by another. The break file is only held for a
+// moment; one left behind by a crash is removed once it is stale itself.
+func breakStale(lockPath string) {
+	if !isStale(lockPath) {
+		return
+	}
+	breakPath := lockPath + ".break"
+	file, err := os.OpenFile(breakPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		if isStale(breakPath) {
+			os.Remove(breakPath)
+		}
+		return
+	}
+	file.Close()
+	defer os.Remove(breakPath)
+	if isStale(lockPath) {
+		os.Remove(lockPath)
+	}
+}
+
+// writeAtomic writes the bytes to a temporary file in the directory of
+// path and renames it to path afterwards. Readers thus see either the old
+// or the new file, but never a truncated one.
+func writeAtomic(path string, bs []byte) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, base+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
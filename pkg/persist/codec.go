@@ -0,0 +1,99 @@
+package persist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// File extensions known to Dump and Load. A trailing ".gz" may be appended
+// to either format, e.g. "forest.gob.gz", to compress the file with gzip.
+const (
+	ExtJSON = ".json"
+	ExtGob  = ".gob"
+	ExtGzip = ".gz"
+)
+
+// codec describes the encoding of a model file: JSON (via the model's
+// Marshal and Unmarshal methods) or gob, optionally gzip-compressed.
+type codec struct {
+	binary     bool
+	compressed bool
+}
+
+// codecFor is a helper function that picks the codec by the extension
+// of the given file path.
+func codecFor(filepath string) (codec, error) {
+	var cdc codec
+	ext := path.Ext(filepath)
+	if ext == ExtGzip {
+		cdc.compressed = true
+		ext = path.Ext(strings.TrimSuffix(filepath, ext))
+	}
+	switch ext {
+	case ExtJSON:
+	case ExtGob:
+		cdc.binary = true
+	default:
+		return cdc, fmt.Errorf("unknown model file format %q of %s", ext, filepath)
+	}
+	return cdc, nil
+}
+
+// encode turns the model into bytes. The gob encoding works on the exported
+// struct fields of the model. Fields of interface type, such as the
+// estimator of a Pipeline or the Updater of a LogReg, need gob to know the
+// concrete types they hold, otherwise encoding and decoding fail. Every
+// package that defines such types therefore registers them with
+// gob.Register in its init function.
+func (cdc codec) encode(jn JSONable) ([]byte, error) {
+	var asBytes []byte
+	if cdc.binary {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(jn); err != nil {
+			return nil, err
+		}
+		asBytes = buf.Bytes()
+	} else {
+		bs, err := jn.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		asBytes = bs
+	}
+	if !cdc.compressed {
+		return asBytes, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(asBytes); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode fills the model with the parameters held by the given bytes.
+func (cdc codec) decode(jn JSONable, asBytes []byte) error {
+	if cdc.compressed {
+		zr, err := gzip.NewReader(bytes.NewReader(asBytes))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		asBytes, err = io.ReadAll(zr)
+		if err != nil {
+			return err
+		}
+	}
+	if cdc.binary {
+		return gob.NewDecoder(bytes.NewReader(asBytes)).Decode(jn)
+	}
+	return jn.Unmarshal(asBytes)
+}
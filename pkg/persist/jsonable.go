@@ -11,30 +11,57 @@ type JSONable interface {
 	Unmarshal(bs []byte) error
 }
 
-// Dump saves the trained model parameters to a JSON file.
-// The model must conform with the JSONable interface.
+// Dump saves the trained model parameters to a file. The file format
+// is chosen by the extension of the file path (see codecFor).
+// The model must conform with the JSONable interface. The file is
+// written atomically under a lock so that concurrent or crashing
+// writers never leave a truncated model behind.
 func Dump(jn JSONable, filepath string) error {
-	asBytes, err := jn.Marshal()
+	cdc, err := codecFor(filepath)
 	if err != nil {
-		return fmt.Errorf("cannot marshal %v into JSON bytes", jn)
+		return err
 	}
-	err = os.WriteFile(filepath, asBytes, 0666)
+	asBytes, err := cdc.encode(jn)
 	if err != nil {
-		return fmt.Errorf("cannot write JSON bytes into file %s", filepath)
+		return fmt.Errorf("cannot encode %T: %v", jn, err)
+	}
+	unlock, err := lock(filepath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = writeAtomic(filepath, asBytes)
+	if err != nil {
+		return fmt.Errorf("cannot write model bytes into file %s: %v", filepath, err)
 	}
 	return nil
 }
 
-// Load takes the model parameters from a JSONfile and lets the model
-// fill its struct fields.
+// Load takes the model parameters from a file and lets the model
+// fill its struct fields. The file format is chosen by the extension
+// of the file path (see codecFor).
 func Load(jn JSONable, filepath string) error {
+	cdc, err := codecFor(filepath)
+	if err != nil {
+		return err
+	}
 	asBytes, err := os.ReadFile(filepath)
 	if err != nil {
 		return fmt.Errorf("cannot read from file %s: %v", filepath, err)
 	}
-	err = jn.Unmarshal(asBytes)
+	err = cdc.decode(jn, asBytes)
 	if err != nil {
-		return fmt.Errorf("cannot unmarshal JSON bytes: %v", err)
+		return fmt.Errorf("cannot decode model bytes: %v", err)
 	}
 	return nil
 }
+
+// Convert loads the model from the file src and saves it to the file dst.
+// Together with the extensions this converts between the file formats,
+// e.g. from "forest.json" to "forest.gob.gz".
+func Convert(jn JSONable, src, dst string) error {
+	if err := Load(jn, src); err != nil {
+		return err
+	}
+	return Dump(jn, dst)
+}
@@ -0,0 +1,76 @@
+package persist
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"grokml/pkg/ch06-logreg"
+	vc "grokml/pkg/vector"
+)
+
+// model is a minimal JSONable for testing.
+type model struct {
+	Name    string    `json:"name"`
+	Weights []float64 `json:"weights"`
+}
+
+func (m model) Marshal() ([]byte, error) {
+	return json.MarshalIndent(m, "", "    ")
+}
+
+func (m *model) Unmarshal(bs []byte) error {
+	return json.Unmarshal(bs, m)
+}
+
+func TestDumpLoad(t *testing.T) {
+	dir := t.TempDir()
+	m := &model{Name: "lin", Weights: []float64{0.5, -1.25, 3}}
+	for _, name := range []string{"m.json", "m.gob", "m.json.gz", "m.gob.gz"} {
+		path := filepath.Join(dir, name)
+		if err := Dump(m, path); err != nil {
+			t.Fatalf("cannot dump to %s: %v", name, err)
+		}
+		got := &model{}
+		if err := Load(got, path); err != nil {
+			t.Fatalf("cannot load from %s: %v", name, err)
+		}
+		if got.Name != m.Name || len(got.Weights) != len(m.Weights) {
+			t.Errorf("%s: expected %v, got %v", name, m, got)
+			continue
+		}
+		for i, w := range m.Weights {
+			if got.Weights[i] != w {
+				t.Errorf("%s: expected weight %v, got %v", name, w, got.Weights[i])
+			}
+		}
+	}
+	if err := Dump(m, filepath.Join(dir, "m.txt")); err == nil {
+		t.Errorf("expected error for unknown file format")
+	}
+}
+
+func TestConvert(t *testing.T) {
+	dir := t.TempDir()
+	lr := ch06.NewNumLogReg(0, 0.0)
+	lr.Updater.Init(2)
+	lr.Updater.Update(vc.Vector{1, 2}, 0.5)
+	src, dst := filepath.Join(dir, "lr.json"), filepath.Join(dir, "lr.gob.gz")
+	if err := Dump(lr, src); err != nil {
+		t.Fatalf("cannot dump: %v", err)
+	}
+	if err := Convert(ch06.NewNumLogReg(0, 0.0), src, dst); err != nil {
+		t.Fatalf("cannot convert: %v", err)
+	}
+	got := &ch06.LogReg[vc.Vector]{}
+	if err := Load(got, dst); err != nil {
+		t.Fatalf("cannot load: %v", err)
+	}
+	dpoints := []vc.Vector{{1, 1}, {-2, 3}}
+	exp := lr.Predict(dpoints)
+	for i, pred := range got.Predict(dpoints) {
+		if pred != exp[i] {
+			t.Errorf("expected prediction %v, got %v", exp[i], pred)
+		}
+	}
+}
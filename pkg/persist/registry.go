@@ -0,0 +1,313 @@
+package persist
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stage tags a model version as ready for a deployment stage.
+type Stage string
+
+const (
+	Staging    Stage = "staging"
+	Production Stage = "production"
+)
+
+// indexFile is the name of the file that keeps track of the versions
+// of a model inside its registry folder.
+const indexFile = "index.json"
+
+// Version describes a saved version of a named model.
+type Version struct {
+	Version int       `json:"version"`
+	File    string    `json:"file"`
+	Created time.Time `json:"created"`
+}
+
+// index is the content of a model's index file. The history of a stage
+// lists the versions that have been promoted to it, the current one last.
+// NextVersion is the number of the next saved version; it only grows, so
+// numbers of removed versions are not reused.
+type index struct {
+	Name        string          `json:"name"`
+	Versions    []Version       `json:"versions"`
+	Stages      map[Stage][]int `json:"stages"`
+	NextVersion int             `json:"next_version"`
+}
+
+// current returns the version currently tagged with the stage or 0.
+func (ix index) current(stage Stage) int {
+	history := ix.Stages[stage]
+	if len(history) == 0 {
+		return 0
+	}
+	return history[len(history)-1]
+}
+
+// lookup returns the version with the given number. The number 0 picks
+// the latest version.
+func (ix index) lookup(version int) (Version, bool) {
+	if len(ix.Versions) == 0 {
+		return Version{}, false
+	}
+	if version == 0 {
+		return ix.Versions[len(ix.Versions)-1], true
+	}
+	for _, v := range ix.Versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// Registry implements a simple on-disk model registry. Every named model
+// gets a folder inside Root which holds its numbered versions, saved with
+// the file extension Ext, and an index file with their stage tags.
+type Registry struct {
+	Root string
+	Ext  string
+}
+
+// NewRegistry is the constructor function for Registry. Models are saved
+// as JSON; set Ext to use another format of Dump.
+func NewRegistry(root string) *Registry {
+	return &Registry{Root: root, Ext: ExtJSON}
+}
+
+// dir returns the folder of the named model.
+func (rg *Registry) dir(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid model name %q", name)
+	}
+	return filepath.Join(rg.Root, name), nil
+}
+
+// readIndex reads the index of the named model. A model without versions
+// has an empty index.
+func (rg *Registry) readIndex(name string) (index, error) {
+	ix := index{Name: name, Stages: map[Stage][]int{}}
+	dir, err := rg.dir(name)
+	if err != nil {
+		return ix, err
+	}
+	bs, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if os.IsNotExist(err) {
+		return ix, nil
+	} else if err != nil {
+		return ix, fmt.Errorf("cannot read index of model %s: %v", name, err)
+	}
+	if err := json.Unmarshal(bs, &ix); err != nil {
+		return ix, fmt.Errorf("cannot unmarshal index of model %s: %v", name, err)
+	}
+	if ix.Stages == nil {
+		ix.Stages = map[Stage][]int{}
+	}
+	return ix, nil
+}
+
+// update applies fn to the index of the named model and writes it back.
+// The index is locked meanwhile so that concurrent updates do not get lost.
+func (rg *Registry) update(name string, fn func(ix *index) error) error {
+	dir, err := rg.dir(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create registry folder %s: %v", dir, err)
+	}
+	path := filepath.Join(dir, indexFile)
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	ix, err := rg.readIndex(name)
+	if err != nil {
+		return err
+	}
+	if err := fn(&ix); err != nil {
+		return err
+	}
+	bs, err := json.MarshalIndent(ix, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, bs)
+}
+
+// Save adds the model as a new version of the named model and returns
+// its version number. Version numbers start at 1 and are never reused,
+// even after GC has removed the versions.
+func (rg *Registry) Save(jn JSONable, name string) (int, error) {
+	var version int
+	err := rg.update(name, func(ix *index) error {
+		// indices written before NextVersion start after the latest version
+		version = ix.NextVersion
+		if n := len(ix.Versions); n > 0 && version <= ix.Versions[n-1].Version {
+			version = ix.Versions[n-1].Version + 1
+		}
+		if version < 1 {
+			version = 1
+		}
+		ix.NextVersion = version + 1
+		file := fmt.Sprintf("v%d%s", version, rg.Ext)
+		dir, _ := rg.dir(name)
+		if err := Dump(jn, filepath.Join(dir, file)); err != nil {
+			return err
+		}
+		ix.Versions = append(ix.Versions, Version{version, file, time.Now().UTC()})
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Load fills the model with the given version of the named model.
+// Version 0 loads the latest version.
+func (rg *Registry) Load(jn JSONable, name string, version int) error {
+	ix, err := rg.readIndex(name)
+	if err != nil {
+		return err
+	}
+	v, ok := ix.lookup(version)
+	if !ok {
+		return fmt.Errorf("model %s has no version %d", name, version)
+	}
+	dir, _ := rg.dir(name)
+	return Load(jn, filepath.Join(dir, v.File))
+}
+
+// LoadStage fills the model with the version of the named model that
+// is currently tagged with the stage.
+func (rg *Registry) LoadStage(jn JSONable, name string, stage Stage) error {
+	ix, err := rg.readIndex(name)
+	if err != nil {
+		return err
+	}
+	version := ix.current(stage)
+	if version == 0 {
+		return fmt.Errorf("model %s has no %s version", name, stage)
+	}
+	return rg.Load(jn, name, version)
+}
+
+// Promote tags the given version of the named model with the stage.
+// Version 0 promotes the latest version.
+func (rg *Registry) Promote(name string, version int, stage Stage) error {
+	return rg.update(name, func(ix *index) error {
+		v, ok := ix.lookup(version)
+		if !ok {
+			return fmt.Errorf("model %s has no version %d", name, version)
+		}
+		if ix.current(stage) != v.Version {
+			ix.Stages[stage] = append(ix.Stages[stage], v.Version)
+		}
+		return nil
+	})
+}
+
+// Rollback tags the stage of the named model with the version it had
+// before the last promotion and returns that version.
+func (rg *Registry) Rollback(name string, stage Stage) (int, error) {
+	var version int
+	err := rg.update(name, func(ix *index) error {
+		history := ix.Stages[stage]
+		if len(history) < 2 {
+			return fmt.Errorf("model %s has no earlier %s version", name, stage)
+		}
+		ix.Stages[stage] = history[:len(history)-1]
+		version = ix.current(stage)
+		return nil
+	})
+	return version, err
+}
+
+// Models lists the names of the models in the registry.
+func (rg *Registry) Models() ([]string, error) {
+	entries, err := os.ReadDir(rg.Root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(rg.Root, entry.Name(), indexFile)); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Versions lists the versions of the named model, oldest first.
+func (rg *Registry) Versions(name string) ([]Version, error) {
+	ix, err := rg.readIndex(name)
+	return ix.Versions, err
+}
+
+// Stages returns the versions of the named model currently tagged with a stage.
+func (rg *Registry) Stages(name string) (map[Stage]int, error) {
+	ix, err := rg.readIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	stages := make(map[Stage]int, len(ix.Stages))
+	for stage := range ix.Stages {
+		if version := ix.current(stage); version > 0 {
+			stages[stage] = version
+		}
+	}
+	return stages, nil
+}
+
+// GC removes the versions of the named model except for the keep latest
+// ones and those currently tagged with a stage. Removed versions are also
+// dropped from the stage histories. It returns the removed version numbers.
+func (rg *Registry) GC(name string, keep int) ([]int, error) {
+	var removed []int
+	err := rg.update(name, func(ix *index) error {
+		tagged := map[int]bool{}
+		for stage := range ix.Stages {
+			tagged[ix.current(stage)] = true
+		}
+		dir, _ := rg.dir(name)
+		cut := len(ix.Versions) - keep
+		var kept []Version
+		for i, v := range ix.Versions {
+			if i >= cut || tagged[v.Version] {
+				kept = append(kept, v)
+				continue
+			}
+			err := os.Remove(filepath.Join(dir, v.File))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed = append(removed, v.Version)
+		}
+		ix.Versions = kept
+		for stage, history := range ix.Stages {
+			var pruned []int
+			for _, version := range history {
+				_, ok := ix.lookup(version)
+				if ok && (len(pruned) == 0 || pruned[len(pruned)-1] != version) {
+					pruned = append(pruned, version)
+				}
+			}
+			ix.Stages[stage] = pruned
+		}
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,117 @@
+package persist
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	rg := NewRegistry(t.TempDir())
+	for i := 1; i <= 3; i++ {
+		m := &model{Name: "lin", Weights: []float64{float64(i)}}
+		version, err := rg.Save(m, "lin")
+		if err != nil {
+			t.Fatalf("cannot save version %d: %v", i, err)
+		}
+		if version != i {
+			t.Errorf("expected version %d, got %d", i, version)
+		}
+		if err := rg.Promote("lin", version, Production); err != nil {
+			t.Fatalf("cannot promote version %d: %v", version, err)
+		}
+	}
+	got := &model{}
+	if err := rg.LoadStage(got, "lin", Production); err != nil {
+		t.Fatalf("cannot load production model: %v", err)
+	}
+	if got.Weights[0] != 3 {
+		t.Errorf("expected production weight 3, got %v", got.Weights[0])
+	}
+	version, err := rg.Rollback("lin", Production)
+	if err != nil || version != 2 {
+		t.Errorf("expected rollback to version 2, got %d (%v)", version, err)
+	}
+	if err := rg.Load(got, "lin", 1); err != nil || got.Weights[0] != 1 {
+		t.Errorf("expected version 1 with weight 1, got %v (%v)", got.Weights, err)
+	}
+	removed, err := rg.GC("lin", 0)
+	if err != nil {
+		t.Fatalf("cannot collect garbage: %v", err)
+	}
+	if len(removed) != 2 || removed[0] != 1 || removed[1] != 3 {
+		t.Errorf("expected versions [1 3] to be removed, got %v", removed)
+	}
+	versions, _ := rg.Versions("lin")
+	if len(versions) != 1 || versions[0].Version != 2 {
+		t.Errorf("expected only version 2 to be kept, got %v", versions)
+	}
+	// The numbers of removed versions are not reused.
+	if version, err := rg.Save(got, "lin"); err != nil || version != 4 {
+		t.Errorf("expected version 4, got %d (%v)", version, err)
+	}
+	names, _ := rg.Models()
+	if len(names) != 1 || names[0] != "lin" {
+		t.Errorf("expected model list [lin], got %v", names)
+	}
+	if _, err := rg.Save(got, "../lin"); err == nil {
+		t.Errorf("expected error for invalid model name")
+	}
+}
+
+func TestDumpAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "m.json")
+	if err := Dump(&model{Name: "lin"}, path); err != nil {
+		t.Fatalf("cannot dump: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the model file, got %d files", len(entries))
+	}
+}
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	lockPath := path + ".lock"
+	// A stale lock of a crashed process is broken.
+	if err := os.WriteFile(lockPath, []byte("crashed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * staleLock)
+	os.Chtimes(lockPath, old, old)
+	unlock, err := lock(path)
+	if err != nil {
+		t.Fatalf("cannot break stale lock: %v", err)
+	}
+	// Releasing a lock that has been taken over leaves it alone.
+	os.WriteFile(lockPath, []byte("other"), 0644)
+	unlock()
+	if bs, err := os.ReadFile(lockPath); err != nil || string(bs) != "other" {
+		t.Errorf("expected the lock of the other owner to be kept, got %q (%v)", bs, err)
+	}
+	os.Remove(lockPath)
+
+	// Concurrent saves get distinct versions.
+	rg := NewRegistry(t.TempDir())
+	versions := make([]int, 8)
+	var wg sync.WaitGroup
+	for i := range versions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			versions[i], _ = rg.Save(&model{Name: "lin"}, "lin")
+		}(i)
+	}
+	wg.Wait()
+	seen := map[int]bool{}
+	for _, version := range versions {
+		if version < 1 || version > len(versions) || seen[version] {
+			t.Errorf("expected distinct versions 1 to %d, got %v", len(versions), versions)
+			break
+		}
+		seen[version] = true
+	}
+}
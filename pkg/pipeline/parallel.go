@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Parallel calls fn for the indices 0, ..., n-1 with a pool of nJobs
+// goroutines and waits for all calls to return. With nJobs of 0 or 1, the
+// calls are made one after another; with a negative nJobs, there is one
+// goroutine per CPU. The calls must not depend on each other: results are
+// to be written to places owned by the index and combined by the caller
+// in index order, which keeps them independent of the number of goroutines.
+func Parallel(nJobs int, n int, fn func(i int)) {
+	if nJobs < 0 {
+		nJobs = runtime.NumCPU()
+	}
+	if nJobs > n {
+		nJobs = n
+	}
+	if nJobs <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(nJobs)
+	for w := 0; w < nJobs; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
@@ -2,6 +2,7 @@ package pipeline
 
 import (
 	"encoding/json"
+	"fmt"
 
 	tk "grokml/pkg/tokens"
 	vc "grokml/pkg/vector"
@@ -37,6 +38,33 @@ type Estimator[O OutType] interface {
 	Score(dpoints []O, labels []float64) float64
 }
 
+// WeightedEstimator is the interface of estimators that can be trained
+// with sample weights. Examples of weight w count like w repeated examples,
+// which allows for compensating class imbalance or for boosting.
+type WeightedEstimator[O OutType] interface {
+	Estimator[O]
+	FitWeighted(dpoints []O, labels []float64, weights []float64) []float64
+}
+
+// UnitWeights returns n sample weights of 1, the weights of an unweighted fit.
+func UnitWeights(n int) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1.0
+	}
+	return weights
+}
+
+// ProbabilisticEstimator is the interface of classifiers that estimate
+// the probability of a data point to belong to the positive class (label 1).
+// PredictClass turns these probabilities into labels: a data point is
+// labelled 1 if its probability exceeds the threshold.
+type ProbabilisticEstimator[O OutType] interface {
+	Estimator[O]
+	PredictProba(dpoints []O) []float64
+	PredictClass(dpoints []O, threshold float64) []float64
+}
+
 // Pipeline implements the ML pipeline concept. It consists of a
 // transformer that transforms the data into a form digestable
 // for the estimator.
@@ -60,22 +88,69 @@ func (pl *Pipeline[I, O]) Fit(dpoints [][]I, labels []float64) []float64 {
 	return pl.Estimator.Fit(tdpoints, labels)
 }
 
-// Predict implements the prediction method. It returns the predicted labels.
-func (pl *Pipeline[I, O]) Predict(dpoints [][]I) []float64 {
+// FitWeighted implements the training of the pipeline with sample weights,
+// which are passed through to the estimator. It returns the epoch errors,
+// or an error if the estimator is no WeightedEstimator.
+func (pl *Pipeline[I, O]) FitWeighted(dpoints [][]I, labels []float64, weights []float64) ([]float64, error) {
+	est, ok := pl.Estimator.(WeightedEstimator[O])
+	if !ok {
+		return nil, fmt.Errorf("estimator %T does not accept sample weights", pl.Estimator)
+	}
 	tdpoints := pl.Transformer.Transform(dpoints)
 	if pl.Scaler != nil {
-		tdpoints = pl.Scaler.Transform(tdpoints)
+		pl.Scaler.Fit(tdpoints)
 	}
-	return pl.Estimator.Predict(tdpoints)
+	return est.FitWeighted(tdpoints, labels, weights), nil
 }
 
-// Score computes the accuracy of the estimator on the given dataset.
-func (pl *Pipeline[I, O]) Score(dpoints [][]I, labels []float64) float64 {
+// transform is a helper method that passes the data points through
+// the transformer and the scaler.
+func (pl *Pipeline[I, O]) transform(dpoints [][]I) []O {
 	tdpoints := pl.Transformer.Transform(dpoints)
 	if pl.Scaler != nil {
 		tdpoints = pl.Scaler.Transform(tdpoints)
 	}
-	return pl.Estimator.Score(tdpoints, labels)
+	return tdpoints
+}
+
+// Predict implements the prediction method. It returns the predicted labels.
+func (pl *Pipeline[I, O]) Predict(dpoints [][]I) []float64 {
+	return pl.Estimator.Predict(pl.transform(dpoints))
+}
+
+// probabilistic is a helper method that returns the estimator as a
+// ProbabilisticEstimator or an error if it is none.
+func (pl *Pipeline[I, O]) probabilistic() (ProbabilisticEstimator[O], error) {
+	est, ok := pl.Estimator.(ProbabilisticEstimator[O])
+	if !ok {
+		return nil, fmt.Errorf("estimator %T does not predict probabilities", pl.Estimator)
+	}
+	return est, nil
+}
+
+// PredictProba returns the probabilities of the positive class as estimated
+// by the estimator. It fails if the estimator is no ProbabilisticEstimator.
+func (pl *Pipeline[I, O]) PredictProba(dpoints [][]I) ([]float64, error) {
+	est, err := pl.probabilistic()
+	if err != nil {
+		return nil, err
+	}
+	return est.PredictProba(pl.transform(dpoints)), nil
+}
+
+// PredictClass returns the labels predicted by the estimator for the given
+// decision threshold. It fails if the estimator is no ProbabilisticEstimator.
+func (pl *Pipeline[I, O]) PredictClass(dpoints [][]I, threshold float64) ([]float64, error) {
+	est, err := pl.probabilistic()
+	if err != nil {
+		return nil, err
+	}
+	return est.PredictClass(pl.transform(dpoints), threshold), nil
+}
+
+// Score computes the accuracy of the estimator on the given dataset.
+func (pl *Pipeline[I, O]) Score(dpoints [][]I, labels []float64) float64 {
+	return pl.Estimator.Score(pl.transform(dpoints), labels)
 }
 
 // Marshal and Unmarshal implement the JSONable interface (pkg/persist).
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"math"
 	"testing"
 
 	tk "grokml/pkg/tokens"
@@ -52,3 +53,118 @@ func TestTransformerII(t *testing.T) {
 		t.Errorf("Expected sum to be %f, got %f", exp, sum(dpoints[0]))
 	}
 }
+
+// stump is a minimal probabilistic estimator for testing. It squashes
+// the first vector component into a probability.
+type stump struct{}
+
+func (st stump) Fit(dpoints []vc.Vector, labels []float64) []float64 { return nil }
+
+// FitWeighted returns the weights it receives.
+func (st stump) FitWeighted(dpoints []vc.Vector, labels []float64, weights []float64) []float64 {
+	return weights
+}
+
+func (st stump) Predict(dpoints []vc.Vector) []float64 {
+	return st.PredictClass(dpoints, 0.5)
+}
+
+func (st stump) PredictProba(dpoints []vc.Vector) []float64 {
+	probs := make([]float64, len(dpoints))
+	for i, dpoint := range dpoints {
+		probs[i] = dpoint[0]
+	}
+	return probs
+}
+
+func (st stump) PredictClass(dpoints []vc.Vector, threshold float64) []float64 {
+	return Classify(st.PredictProba(dpoints), threshold)
+}
+
+func (st stump) Score(dpoints []vc.Vector, labels []float64) float64 { return 0.0 }
+
+// plain is an estimator that neither predicts probabilities nor accepts
+// sample weights.
+type plain struct{}
+
+func (p plain) Fit(dpoints []vc.Vector, labels []float64) []float64 { return nil }
+func (p plain) Predict(dpoints []vc.Vector) []float64               { return nil }
+func (p plain) Score(dpoints []vc.Vector, labels []float64) float64 { return 0.0 }
+
+func TestPipelinePredictProba(t *testing.T) {
+	pline := NewPipeline[float64, vc.Vector](vc.NewVectoriser(false), nil, stump{})
+	dpoints := [][]float64{{0.2}, {0.6}, {0.9}}
+	probs, err := pline.PredictProba(dpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, dpoint := range dpoints {
+		if probs[i] != dpoint[0] {
+			t.Errorf("expected probability %v, got %v", dpoint[0], probs[i])
+		}
+	}
+	got, err := pline.PredictClass(dpoints, 0.7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []float64{0, 0, 1}
+	for i, label := range exp {
+		if got[i] != label {
+			t.Errorf("expected label %v, got %v", label, got[i])
+		}
+	}
+}
+
+func TestPipelineUnsupported(t *testing.T) {
+	pline := NewPipeline[float64, vc.Vector](vc.NewVectoriser(false), nil, plain{})
+	if _, err := pline.PredictProba([][]float64{{0.2}}); err == nil {
+		t.Error("expected an error for an estimator without probabilities")
+	}
+	if _, err := pline.PredictClass([][]float64{{0.2}}, 0.5); err == nil {
+		t.Error("expected an error for an estimator without probabilities")
+	}
+	if _, err := pline.FitWeighted([][]float64{{0.2}}, []float64{0}, []float64{1}); err == nil {
+		t.Error("expected an error for an estimator without sample weights")
+	}
+}
+
+func TestGetMultiReport(t *testing.T) {
+	preds := []float64{0, 1, 2, 2}
+	labels := []float64{0, 1, 2, 1}
+	rep := GetMultiReport(preds, labels)
+	if rep.Accuracy != 0.75 {
+		t.Errorf("expected accuracy 0.75, got %.4f", rep.Accuracy)
+	}
+	// precisions 1, 1, 1/2 and recalls 1, 1/2, 1
+	if exp := 2.5 / 3.0; math.Abs(rep.Precision-exp) > 1e-9 || math.Abs(rep.Recall-exp) > 1e-9 {
+		t.Errorf("expected macro precision and recall %.4f, got %+v", exp, rep)
+	}
+}
+
+func TestPipelineFitWeighted(t *testing.T) {
+	pline := NewPipeline[float64, vc.Vector](vc.NewVectoriser(false), nil, stump{})
+	weights := []float64{0.5, 2.0}
+	got, err := pline.FitWeighted([][]float64{{0.2}, {0.6}}, []float64{0, 1}, weights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range weights {
+		if got[i] != w {
+			t.Errorf("expected weight %v, got %v", w, got[i])
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	for _, nJobs := range []int{0, 1, 3, -1} {
+		squares := make([]int, 10)
+		Parallel(nJobs, len(squares), func(i int) {
+			squares[i] = i * i
+		})
+		for i, sq := range squares {
+			if sq != i*i {
+				t.Errorf("%d jobs: expected %d at %d, got %d", nJobs, i*i, i, sq)
+			}
+		}
+	}
+}
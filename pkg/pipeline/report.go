@@ -61,6 +61,60 @@ func GetReport(predictions []float64, labels []float64) Report {
 	}
 }
 
+// GetMultiReport computes the Report struct quantities for labels of more
+// than two classes. Precision, recall and specificity are computed for each
+// class against the rest and averaged over the classes (macro average).
+func GetMultiReport(predictions []float64, labels []float64) Report {
+	classes := map[float64]bool{}
+	var correct float64
+	for i, p := range predictions {
+		classes[p], classes[labels[i]] = true, true
+		if p == labels[i] {
+			correct++
+		}
+	}
+	var rep Report
+	for class := range classes {
+		var tp, tn, fp, fn float64
+		for i, p := range predictions {
+			if p == class && labels[i] == class {
+				tp++
+			} else if p == class {
+				fp++
+			} else if labels[i] == class {
+				fn++
+			} else {
+				tn++
+			}
+		}
+		if tp > 0.0 {
+			rep.Precision += tp / (tp + fp)
+			rep.Recall += tp / (tp + fn)
+		}
+		if tn > 0.0 {
+			rep.Specificity += tn / (tn + fp)
+		}
+	}
+	size := float64(len(classes))
+	rep.Accuracy = correct / float64(len(predictions))
+	rep.Precision /= size
+	rep.Recall /= size
+	rep.Specificity /= size
+	return rep
+}
+
+// Classify turns probabilities into labels: 1 if the probability exceeds
+// the threshold, 0 otherwise.
+func Classify(probs []float64, threshold float64) []float64 {
+	labels := make([]float64, len(probs))
+	for i, p := range probs {
+		if p > threshold {
+			labels[i] = 1.0
+		}
+	}
+	return labels
+}
+
 // getCoD is a helper function to compute the coefficient of determination.
 // As a measure of performance for regression trees, it compares the mean-squared
 // error with that of a regressor which predicts the label mean for every data point.
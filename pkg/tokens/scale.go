@@ -17,6 +17,16 @@ func (sc NonScaler) Transform(tmaps []TokenMap) []TokenMap {
 	return tmaps
 }
 
+// MarshalBinary and UnmarshalBinary let gob (persist pkg) encode the
+// empty struct.
+func (sc NonScaler) MarshalBinary() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (sc *NonScaler) UnmarshalBinary(bs []byte) error {
+	return nil
+}
+
 // Marshal and Unmarshal implement the JSONable interface (persist pkg).
 func (sc NonScaler) Marshal() ([]byte, error) {
 	return json.MarshalIndent(sc, "", "    ")
@@ -1,9 +1,16 @@
 package tokens
 
 import (
+	"encoding/gob"
 	"strings"
 )
 
+// init registers the tokeniser and the scaler with gob.
+func init() {
+	gob.Register(&Tokeniser{})
+	gob.Register(&NonScaler{})
+}
+
 // TokenMap implements a mapping from tokens to floats. It acts as a vector with
 // a float parameter for every word, ie token, as obtained from text data, and all
 // the required canonical vector operations.
@@ -49,6 +56,20 @@ func NewTokeniser(toLower bool) *Tokeniser {
 	return &Tokeniser{toLower}
 }
 
+// MarshalBinary and UnmarshalBinary let gob (persist pkg) encode the
+// unexported lower-casing flag.
+func (t Tokeniser) MarshalBinary() ([]byte, error) {
+	if t.toLower {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+func (t *Tokeniser) UnmarshalBinary(bs []byte) error {
+	t.toLower = len(bs) > 0 && bs[0] == 1
+	return nil
+}
+
 // Transform is the defining method for Transformers: it takes a slice of
 // string slices - construed as documents - and returns a token map for every
 // document.
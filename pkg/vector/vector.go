@@ -4,6 +4,7 @@
 package vector
 
 import (
+	"encoding/gob"
 	"math"
 	"math/rand"
 	"time"
@@ -12,6 +13,9 @@ import (
 func init() {
 	seed := time.Now().UnixNano()
 	rand.Seed(seed)
+	// register the vectoriser and the scaler with gob
+	gob.Register(&Vectoriser{})
+	gob.Register(&Scaler{})
 }
 
 type Vector []float64